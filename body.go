@@ -0,0 +1,173 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/net/html/charset"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// BodyTooLargeError is returned when a response body exceeds the limit set by MaxBodySize
+type BodyTooLargeError struct {
+	Limit int64
+}
+
+// Error implements the error interface
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("response body exceeds the limit of %d bytes", e.Limit)
+}
+
+// MaxBodySize limits the number of decoded bytes read from the response body,
+// reading more fails with a *BodyTooLargeError. 0 means no limit
+func (g *GHttpClient) MaxBodySize(n int64) *GHttpClient {
+	g.maxBodySize = n
+	return g
+}
+
+// Stream returns the response body decoded from its content coding, and converted to UTF-8 for a text
+// with another charset, so that a large body can be processed without being buffered. It must be closed
+func (g *GHttpClient) Stream() (io.ReadCloser, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+	done := g.countBody()
+	body, err := decodeBody(g.response, g.maxBodySize)
+	if err != nil {
+		g.response.Body.Close()
+		done()
+		return nil, err
+	}
+	return &doneBody{
+		Reader: toUTF8(body, g.response.Header.Get("Content-Type"), false),
+		Closer: body,
+		done:   done,
+	}, nil
+}
+
+// SaveTo copies the stream of the response body to w, then close the Body
+// It returns the number of bytes written
+func (g *GHttpClient) SaveTo(w io.Writer) (int64, error) {
+	body, err := g.Stream()
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	return io.Copy(w, body)
+}
+
+// decodeBody returns the response body decoded from its content coding,
+// limited to maxBodySize decoded bytes if positive. Closing it closes the response body
+func decodeBody(response *http.Response, maxBodySize int64) (io.ReadCloser, error) {
+	if response == nil {
+		return nil, errors.New("response  is nil")
+	}
+
+	reader, decoders, err := decompress(response.Body, response.Header)
+	if err != nil {
+		return nil, err
+	}
+	closers := append([]io.Closer{response.Body}, decoders...)
+	if maxBodySize > 0 {
+		reader = &limitedReader{r: reader, remaining: maxBodySize, limit: maxBodySize}
+	}
+	return &multiCloser{Reader: reader, closers: closers}, nil
+}
+
+// toUTF8 converts a text body to UTF-8 according to the charset of the Content-Type, or to the content for an HTML body
+// Other bodies are returned as is, unless sniff is true: then the charset of a body which is not declared binary
+// is determined from its content, as TryUTF8ReadBodyClose does
+func toUTF8(r io.Reader, contentType string, sniff bool) io.Reader {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil && !sniff {
+		return r
+	}
+	if label, ok := params["charset"]; ok {
+		if strings.EqualFold(label, "utf-8") || strings.EqualFold(label, "utf8") {
+			return r
+		}
+		if converted, err := charset.NewReaderLabel(label, r); err == nil {
+			return converted
+		}
+		return r
+	}
+	if strings.HasPrefix(mediaType, "text/") || sniff && !binaryMediaType(mediaType) {
+		if converted, err := charset.NewReader(r, contentType); err == nil {
+			return converted
+		}
+	}
+	return r
+}
+
+// binaryMediaType tells whether a media type is declared binary, such as image/png or application/octet-stream
+// A missing media type, text and the application types of text formats are not binary
+func binaryMediaType(mediaType string) bool {
+	if mediaType == "" || strings.HasPrefix(mediaType, "text/") {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "application/") {
+		for _, text := range []string{"json", "xml", "javascript", "x-www-form-urlencoded"} {
+			if strings.Contains(mediaType, text) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// limitedReader fails with a *BodyTooLargeError after limit bytes
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	limit     int64
+}
+
+// Read implements io.Reader
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, &BodyTooLargeError{Limit: l.limit}
+	}
+	// one more byte than the limit is read to tell whether the body exceeds it
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n + int(l.remaining), &BodyTooLargeError{Limit: l.limit}
+	}
+	return n, err
+}
+
+// multiCloser reads from Reader and closes the closers in reverse order
+type multiCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+// Close implements io.Closer
+func (m *multiCloser) Close() error {
+	return closeAll(m.closers)
+}
+
+// doneBody calls done once closed
+type doneBody struct {
+	io.Reader
+	io.Closer
+	done func()
+}
+
+// Close implements io.Closer
+func (b *doneBody) Close() error {
+	err := b.Closer.Close()
+	if b.done != nil {
+		b.done()
+		b.done = nil
+	}
+	return err
+}
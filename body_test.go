@@ -0,0 +1,84 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient_test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/panwenbin/ghttpclient"
+	"github.com/panwenbin/ghttpclient/header"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/transform"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestStream(t *testing.T) {
+	server := newEchoServer(t)
+	utf8Str := "你好，世界"
+	gbkStr, _, _ := transform.String(simplifiedchinese.GBK.NewEncoder(), utf8Str)
+
+	var bodyRead ghttpclient.Event
+	stream, err := ghttpclient.NewClient().Url(server.URL + "/gbk").
+		Headers(header.GHttpHeader{}.AcceptEncodingGzip()).Body(strings.NewReader(gbkStr)).
+		Logger(ghttpclient.LoggerFunc(func(event ghttpclient.Event) {
+			if event.Kind == ghttpclient.EventBodyRead {
+				bodyRead = event
+			}
+		})).Post().Stream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(stream)
+	stream.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != utf8Str {
+		t.Errorf("expect %s, got %s", utf8Str, body)
+	}
+	if bodyRead.Bytes == 0 {
+		t.Error("expect the body read to be logged when the stream is closed")
+	}
+}
+
+func TestSaveTo(t *testing.T) {
+	server := newEchoServer(t)
+	content := strings.Repeat("ghttpclient", 10000)
+
+	buffer := &bytes.Buffer{}
+	n, err := ghttpclient.NewClient().Url(server.URL).Headers(header.GHttpHeader{}.AcceptEncodingGzip()).
+		Body(strings.NewReader(content)).Post().SaveTo(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(content)) || buffer.String() != content {
+		t.Errorf("expect %d bytes, got %d", len(content), n)
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	server := newEchoServer(t)
+	content := strings.Repeat("ghttpclient", 1000)
+
+	_, err := ghttpclient.NewClient().Url(server.URL).Headers(header.GHttpHeader{}.AcceptEncodingGzip()).
+		Body(strings.NewReader(content)).MaxBodySize(1000).Post().ReadBodyClose()
+	var tooLarge *ghttpclient.BodyTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.Limit != 1000 {
+		t.Errorf("expect a body too large error with a limit of 1000, got %v", err)
+	}
+
+	_, err = ghttpclient.NewClient().Url(server.URL).Body(strings.NewReader(content)).
+		MaxBodySize(1000).Post().SaveTo(ioutil.Discard)
+	if !errors.As(err, &tooLarge) {
+		t.Errorf("expect a body too large error, got %v", err)
+	}
+
+	body, err := ghttpclient.NewClient().Url(server.URL).Body(strings.NewReader(content)).
+		MaxBodySize(int64(len(content))).Post().ReadBodyClose()
+	if err != nil || len(body) != len(content) {
+		t.Errorf("expect a body at the limit to be read, got %d bytes and %v", len(body), err)
+	}
+}
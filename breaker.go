@@ -0,0 +1,289 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is matched by the errors of the requests rejected by an open circuit
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitOpenError is returned for a request rejected by an open circuit of a CircuitBreaker
+type CircuitOpenError struct {
+	Key string
+}
+
+// Error implements the error interface
+func (e *CircuitOpenError) Error() string {
+	return "circuit open for " + e.Key
+}
+
+// Is makes the error match ErrCircuitOpen
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// CircuitState is the state of a circuit
+type CircuitState int
+
+const (
+	// CircuitClosed lets the requests through
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects the requests until the cool-down is over
+	CircuitOpen
+	// CircuitHalfOpen lets a few probe requests through, which close the circuit if they succeed
+	CircuitHalfOpen
+)
+
+// String returns the name of the state
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreaker fails the requests fast while the upstream of their circuit is failing,
+// with a circuit per host or per key
+type CircuitBreaker struct {
+	// Key returns the circuit key of a request, the host by default
+	Key func(request *http.Request) string
+	// ConsecutiveFailures opens a circuit after as many consecutive failures, 0 disables it
+	ConsecutiveFailures int
+	// FailureRatio opens a circuit when the ratio of failed requests within a window reaches it,
+	// once MinRequests requests have been counted, 0 disables it
+	FailureRatio float64
+	MinRequests  int
+	// Window is the duration after which the counts of a closed circuit are reset, 0 never resets them
+	Window time.Duration
+	// CoolDown is how long an open circuit rejects the requests before turning half-open
+	CoolDown time.Duration
+	// HalfOpenProbes is the number of probe requests let through by a half-open circuit,
+	// which all have to succeed to close it
+	HalfOpenProbes int
+	// IsFailure tells whether the result of a request is a failure, an error or a 5xx status code by default
+	IsFailure func(response *http.Response, err error) bool
+	// OnStateChange is called when the state of a circuit changes
+	OnStateChange func(key string, from, to CircuitState)
+	// Now returns the current time, time.Now by default
+	Now func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// NewCircuitBreaker returns a CircuitBreaker with a circuit per host, opened after 5 consecutive failures
+// or a 50% failure ratio of at least 20 requests within 1 minute, cooling down for 30s with 1 probe
+func NewCircuitBreaker() *CircuitBreaker {
+	return &CircuitBreaker{
+		ConsecutiveFailures: 5,
+		FailureRatio:        0.5,
+		MinRequests:         20,
+		Window:              time.Minute,
+		CoolDown:            30 * time.Second,
+		HalfOpenProbes:      1,
+	}
+}
+
+// CircuitBreaker fails the requests of the client fast while their circuit is open
+func (g *GHttpClient) CircuitBreaker(breaker *CircuitBreaker) *GHttpClient {
+	return g.Use(breaker.Middleware())
+}
+
+// circuit is the state of the requests of a key
+type circuit struct {
+	state CircuitState
+	// generation changes with the state, results of requests let through in a previous state are ignored
+	generation  int
+	consecutive int
+	requests    int
+	failures    int
+	since       time.Time
+	probes      int
+	successes   int
+}
+
+// circuitChange is a state change to notify
+type circuitChange struct {
+	key      string
+	from, to CircuitState
+}
+
+// Middleware returns a Middleware rejecting the requests of open circuits, and recording the results of the others
+func (b *CircuitBreaker) Middleware() Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(request *http.Request) (*http.Response, error) {
+			key := b.key(request)
+			generation, err := b.allow(key)
+			if err != nil {
+				return nil, err
+			}
+			response, err := next(request)
+			b.record(key, generation, response, err)
+			return response, err
+		}
+	}
+}
+
+// State returns the state of the circuit of a key
+func (b *CircuitBreaker) State(key string) CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuit(key)
+	if c.state == CircuitOpen && b.now().Sub(c.since) >= b.CoolDown {
+		return CircuitHalfOpen
+	}
+	return c.state
+}
+
+// key returns the circuit key of a request
+func (b *CircuitBreaker) key(request *http.Request) string {
+	if b.Key != nil {
+		return b.Key(request)
+	}
+	return request.URL.Host
+}
+
+// circuit returns the circuit of a key, the lock must be held
+func (b *CircuitBreaker) circuit(key string) *circuit {
+	if b.circuits == nil {
+		b.circuits = make(map[string]*circuit)
+	}
+	c, ok := b.circuits[key]
+	if !ok {
+		c = &circuit{since: b.now()}
+		b.circuits[key] = c
+	}
+	return c
+}
+
+// allow lets a request through, it returns the generation of the circuit or a *CircuitOpenError
+func (b *CircuitBreaker) allow(key string) (int, error) {
+	var changes []circuitChange
+	defer func() {
+		b.notify(changes)
+	}()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuit(key)
+	now := b.now()
+	switch c.state {
+	case CircuitClosed:
+		if b.Window > 0 && now.Sub(c.since) >= b.Window {
+			c.requests, c.failures, c.since = 0, 0, now
+		}
+	case CircuitOpen:
+		if now.Sub(c.since) < b.CoolDown {
+			return 0, &CircuitOpenError{Key: key}
+		}
+		changes = append(changes, b.transition(key, c, CircuitHalfOpen, now))
+		fallthrough
+	case CircuitHalfOpen:
+		if c.probes >= b.halfOpenProbes() {
+			return 0, &CircuitOpenError{Key: key}
+		}
+		c.probes++
+	}
+	return c.generation, nil
+}
+
+// record counts the result of a request let through in a generation of the circuit
+func (b *CircuitBreaker) record(key string, generation int, response *http.Response, err error) {
+	var changes []circuitChange
+	defer func() {
+		b.notify(changes)
+	}()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuit(key)
+	if c.generation != generation {
+		return
+	}
+	now := b.now()
+	// a canceled request tells nothing about the upstream, it only frees its probe
+	if errors.Is(err, context.Canceled) {
+		if c.state == CircuitHalfOpen {
+			c.probes--
+		}
+		return
+	}
+	failure := b.isFailure(response, err)
+	switch c.state {
+	case CircuitClosed:
+		c.requests++
+		if failure {
+			c.failures++
+			c.consecutive++
+		} else {
+			c.consecutive = 0
+		}
+		if (b.ConsecutiveFailures > 0 && c.consecutive >= b.ConsecutiveFailures) ||
+			(b.FailureRatio > 0 && c.requests >= b.MinRequests && float64(c.failures) >= b.FailureRatio*float64(c.requests)) {
+			changes = append(changes, b.transition(key, c, CircuitOpen, now))
+		}
+	case CircuitHalfOpen:
+		if failure {
+			changes = append(changes, b.transition(key, c, CircuitOpen, now))
+			return
+		}
+		c.successes++
+		if c.successes >= b.halfOpenProbes() {
+			changes = append(changes, b.transition(key, c, CircuitClosed, now))
+		}
+	}
+}
+
+// transition changes the state of a circuit and resets its counts, the lock must be held
+func (b *CircuitBreaker) transition(key string, c *circuit, state CircuitState, now time.Time) circuitChange {
+	change := circuitChange{key: key, from: c.state, to: state}
+	c.state = state
+	c.generation++
+	c.since = now
+	c.consecutive, c.requests, c.failures, c.probes, c.successes = 0, 0, 0, 0, 0
+	return change
+}
+
+// notify calls OnStateChange for the changes, without the lock held
+func (b *CircuitBreaker) notify(changes []circuitChange) {
+	if b.OnStateChange == nil {
+		return
+	}
+	for _, change := range changes {
+		b.OnStateChange(change.key, change.from, change.to)
+	}
+}
+
+// isFailure tells whether the result of a request is a failure
+func (b *CircuitBreaker) isFailure(response *http.Response, err error) bool {
+	if b.IsFailure != nil {
+		return b.IsFailure(response, err)
+	}
+	return err != nil || response.StatusCode >= http.StatusInternalServerError
+}
+
+// now returns the current time of the breaker
+func (b *CircuitBreaker) now() time.Time {
+	if b.Now != nil {
+		return b.Now()
+	}
+	return time.Now()
+}
+
+// halfOpenProbes returns the number of probes of a half-open circuit, at least 1
+func (b *CircuitBreaker) halfOpenProbes() int {
+	if b.HalfOpenProbes < 1 {
+		return 1
+	}
+	return b.HalfOpenProbes
+}
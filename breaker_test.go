@@ -0,0 +1,167 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/panwenbin/ghttpclient"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failWhile returns a fail function of newFailingServer failing while failing is set, counting the requests in calls
+func failWhile(failing, calls *int32) func() bool {
+	return func() bool {
+		atomic.AddInt32(calls, 1)
+		return atomic.LoadInt32(failing) == 1
+	}
+}
+
+// fakeClock is a clock which only moves when it is advanced
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// newFakeClock returns a fakeClock starting at the current time
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Now()}
+}
+
+// Now returns the time of the clock
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// answerOK answers 200
+func answerOK(w http.ResponseWriter, r *http.Request) {}
+
+func TestCircuitBreaker(t *testing.T) {
+	failing, calls := int32(1), int32(0)
+	server := newFailingServer(t, failWhile(&failing, &calls), http.HandlerFunc(answerOK))
+	var mu sync.Mutex
+	var changes []string
+	breaker := ghttpclient.NewCircuitBreaker()
+	breaker.ConsecutiveFailures = 3
+	breaker.CoolDown = time.Minute
+	clock := newFakeClock()
+	breaker.Now = clock.Now
+	breaker.OnStateChange = func(key string, from, to ghttpclient.CircuitState) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, fmt.Sprintf("%s>%s", from, to))
+	}
+	policy := ghttpclient.NewRetryPolicy()
+	policy.MinBackoff = time.Millisecond
+	api := ghttpclient.NewTemplate().BaseUrl(server.URL).CircuitBreaker(breaker).Retry(policy)
+
+	api.R().Url("/").Get()
+	_, err := api.R().Url("/").Get().Response()
+	if !errors.Is(err, ghttpclient.ErrCircuitOpen) {
+		t.Fatalf("expect the circuit to be open, got %v", err)
+	}
+	var openErr *ghttpclient.CircuitOpenError
+	if !errors.As(err, &openErr) || breaker.State(openErr.Key) != ghttpclient.CircuitOpen {
+		t.Errorf("expect an open circuit error, got %v", err)
+	}
+	if atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("expect to fail fast without retrying, got %d requests", atomic.LoadInt32(&calls))
+	}
+
+	clock.Advance(time.Minute)
+	api.R().Url("/").Get()
+	clock.Advance(time.Minute)
+	atomic.StoreInt32(&failing, 0)
+	if _, err := api.R().Url("/").Get().Response(); err != nil {
+		t.Fatalf("expect the probe to succeed, got %v", err)
+	}
+	if _, err := api.R().Url("/").Get().Response(); err != nil {
+		t.Fatalf("expect the circuit to be closed, got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{"closed>open", "open>half-open", "half-open>open", "open>half-open", "half-open>closed"}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expect %v, got %v", expected, changes)
+	}
+}
+
+func TestCircuitBreakerFailureRatioAndKey(t *testing.T) {
+	failing, calls := int32(0), int32(0)
+	server := newFailingServer(t, failWhile(&failing, &calls), http.HandlerFunc(answerOK))
+	breaker := ghttpclient.NewCircuitBreaker()
+	breaker.ConsecutiveFailures = 0
+	breaker.MinRequests = 4
+	breaker.Key = func(request *http.Request) string {
+		return request.URL.Path
+	}
+	client := func(path string) *ghttpclient.GHttpClient {
+		return ghttpclient.NewClient().Url(server.URL + path).CircuitBreaker(breaker)
+	}
+
+	for i := 0; i < 4; i++ {
+		atomic.StoreInt32(&failing, int32(i%2))
+		client("/a").Get()
+	}
+	if breaker.State("/a") != ghttpclient.CircuitOpen {
+		t.Errorf("expect a 50%% failure ratio to open the circuit, got %s", breaker.State("/a"))
+	}
+	if _, err := client("/b").Get().Response(); err != nil {
+		t.Errorf("expect the circuit of another key to be closed, got %v", err)
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbes(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-release
+		}
+	}))
+	defer server.Close()
+	breaker := ghttpclient.NewCircuitBreaker()
+	breaker.CoolDown = 0
+	breaker.ConsecutiveFailures = 1
+	breaker.IsFailure = func(response *http.Response, err error) bool {
+		return err != nil || response.Request.URL.Path == "/fail"
+	}
+	client := func(path string) *ghttpclient.GHttpClient {
+		return ghttpclient.NewClient().Url(server.URL + path).CircuitBreaker(breaker)
+	}
+
+	client("/fail").Get()
+	done := make(chan error)
+	go func() {
+		_, err := client("/slow").Get().Response()
+		done <- err
+	}()
+	<-started
+	if _, err := client("/").Get().Response(); !errors.Is(err, ghttpclient.ErrCircuitOpen) {
+		t.Errorf("expect a single probe while half-open, got %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if state := breaker.State(server.Listener.Addr().String()); state != ghttpclient.CircuitClosed {
+		t.Errorf("expect the probe to close the circuit, got %s", state)
+	}
+}
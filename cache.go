@@ -0,0 +1,470 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheStatus tells how a response was obtained through a Cache
+type CacheStatus string
+
+const (
+	// CacheMiss is a response from the server
+	CacheMiss CacheStatus = "miss"
+	// CacheHit is a fresh response from the cache
+	CacheHit CacheStatus = "hit"
+	// CacheRevalidated is a response from the cache, validated by the server with a 304 Not Modified
+	CacheRevalidated CacheStatus = "revalidated"
+	// CacheStale is a stale response from the cache, served while it is revalidated in background
+	CacheStale CacheStatus = "stale"
+)
+
+// DefaultCacheMaxEntrySize is the largest response body stored by a Cache, in bytes
+var DefaultCacheMaxEntrySize int64 = 10 << 20
+
+// cacheableStatus are the status codes whose responses can be stored without explicit freshness
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// Cache is a HTTP cache of GET responses following RFC 9111,
+// it honors Cache-Control, Expires and Vary, and revalidates stale responses with ETag and Last-Modified
+type Cache struct {
+	// Storage stores the entries
+	Storage CacheStorage
+	// Shared makes the cache a shared cache, which does not store private responses and honors s-maxage
+	Shared bool
+	// MaxEntrySize is the largest response body stored, in bytes
+	MaxEntrySize int64
+
+	revalidating sync.Map
+}
+
+// NewCache returns a private Cache storing its entries in storage
+// The responses to requests with an Authorization or a Cookie header are stored only when they are public,
+// have a s-maxage or vary on these headers, so that a Cache can be used by clients of different users
+func NewCache(storage CacheStorage) *Cache {
+	return &Cache{Storage: storage, MaxEntrySize: DefaultCacheMaxEntrySize}
+}
+
+// Cache caches the responses of the client in cache
+func (g *GHttpClient) Cache(cache *Cache) *GHttpClient {
+	return g.Use(cache.Middleware())
+}
+
+// CacheStatus returns the CacheStatus of the response, empty if it was not obtained through a Cache
+func (g *GHttpClient) CacheStatus() CacheStatus {
+	return CacheStatusOf(g.response)
+}
+
+// CacheStatusOf returns the CacheStatus of a response, empty if it was not obtained through a Cache
+// The status is carried by the context of the request of the response, a cache status header of the server is ignored
+func CacheStatusOf(response *http.Response) CacheStatus {
+	if response == nil || response.Request == nil {
+		return ""
+	}
+	status, _ := response.Request.Context().Value(cacheStatusKey{}).(CacheStatus)
+	return status
+}
+
+// cacheStatusKey is the context key of the CacheStatus
+type cacheStatusKey struct{}
+
+// Middleware returns a Middleware answering GET requests from the cache, and invalidating the
+// cached responses of a url on a successful unsafe request
+func (c *Cache) Middleware() Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(request *http.Request) (*http.Response, error) {
+			return c.roundTrip(request, next)
+		}
+	}
+}
+
+// cacheEntry is a stored response
+type cacheEntry struct {
+	Status       string            `json:"status"`
+	StatusCode   int               `json:"status_code"`
+	Header       http.Header       `json:"header"`
+	Body         []byte            `json:"body"`
+	Vary         map[string]string `json:"vary,omitempty"`
+	RequestTime  time.Time         `json:"request_time"`
+	ResponseTime time.Time         `json:"response_time"`
+}
+
+// cacheKey returns the storage key of the responses of a url
+func cacheKey(request *http.Request) string {
+	return http.MethodGet + " " + request.URL.String()
+}
+
+// roundTrip answers a request from the cache, or from next storing the response
+func (c *Cache) roundTrip(request *http.Request, next RoundTripFunc) (*http.Response, error) {
+	key := cacheKey(request)
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		response, err := next(request)
+		if err == nil && response.StatusCode < http.StatusBadRequest {
+			c.Storage.Delete(key)
+		}
+		return response, err
+	}
+	requestControl := parseCacheControl(request.Header)
+	if request.Method != http.MethodGet || requestControl.has("no-store") || request.Header.Get("Range") != "" ||
+		request.Header.Get("If-None-Match") != "" || request.Header.Get("If-Modified-Since") != "" {
+		response, err := next(request)
+		return withCacheStatus(response, request, CacheMiss), err
+	}
+
+	entry := c.load(key, request)
+	if entry == nil {
+		return c.fetch(key, request, next)
+	}
+	now := time.Now()
+	age, lifetime := entry.age(now), entry.freshness(c.Shared)
+	responseControl := parseCacheControl(entry.Header)
+	noCache := requestControl.has("no-cache") || responseControl.has("no-cache") ||
+		(request.Header.Get("Pragma") == "no-cache" && request.Header.Get("Cache-Control") == "")
+	if maxAge, ok := requestControl.seconds("max-age"); ok && age > maxAge {
+		noCache = true
+	}
+	if !noCache && age < lifetime {
+		return entry.response(request, age, CacheHit), nil
+	}
+	if staleWhile, ok := responseControl.seconds("stale-while-revalidate"); ok && !noCache &&
+		!responseControl.has("must-revalidate") && age < lifetime+staleWhile {
+		response := entry.response(request, age, CacheStale)
+		c.revalidateInBackground(key, request, entry, next)
+		return response, nil
+	}
+	return c.revalidate(key, request, entry, next)
+}
+
+// fetch sends the request, and stores the response once its body is read
+func (c *Cache) fetch(key string, request *http.Request, next RoundTripFunc) (*http.Response, error) {
+	requestTime := time.Now()
+	response, err := next(request)
+	if err != nil {
+		return nil, err
+	}
+	c.store(key, request, response, requestTime)
+	return withCacheStatus(response, request, CacheMiss), nil
+}
+
+// revalidate sends the request conditionally to the validators of the entry,
+// a 304 Not Modified refreshes the entry which is returned
+func (c *Cache) revalidate(key string, request *http.Request, entry *cacheEntry, next RoundTripFunc) (*http.Response, error) {
+	conditional := request.Clone(request.Context())
+	if etag := entry.Header.Get("ETag"); etag != "" {
+		conditional.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+		conditional.Header.Set("If-Modified-Since", lastModified)
+	}
+	requestTime := time.Now()
+	response, err := next(conditional)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusNotModified ||
+		(conditional.Header.Get("If-None-Match") == "" && conditional.Header.Get("If-Modified-Since") == "") {
+		c.store(key, request, response, requestTime)
+		return withCacheStatus(response, request, CacheMiss), nil
+	}
+	discardResponse(response)
+
+	for name, values := range response.Header {
+		if name != "Content-Length" {
+			entry.Header[name] = values
+		}
+	}
+	entry.Header.Del("Age")
+	if age := response.Header.Get("Age"); age != "" {
+		entry.Header.Set("Age", age)
+	}
+	entry.RequestTime, entry.ResponseTime = requestTime, time.Now()
+	c.save(key, entry)
+	return entry.response(request, entry.age(time.Now()), CacheRevalidated), nil
+}
+
+// revalidateInBackground revalidates the entry in a goroutine, unless it is already revalidated
+func (c *Cache) revalidateInBackground(key string, request *http.Request, entry *cacheEntry, next RoundTripFunc) {
+	if _, loaded := c.revalidating.LoadOrStore(key, true); loaded {
+		return
+	}
+	// the request context ends with the stale response, the revalidation outlives it
+	background := request.Clone(context.Background())
+	go func() {
+		defer c.revalidating.Delete(key)
+		response, err := c.revalidate(key, background, entry, next)
+		if err == nil {
+			io.Copy(ioutil.Discard, response.Body)
+			response.Body.Close()
+		}
+	}()
+}
+
+// load returns the entry of the key matching the Vary headers of the request, nil if there is none
+func (c *Cache) load(key string, request *http.Request) *cacheEntry {
+	content, ok := c.Storage.Get(key)
+	if !ok {
+		return nil
+	}
+	entry := &cacheEntry{}
+	if err := json.Unmarshal(content, entry); err != nil {
+		c.Storage.Delete(key)
+		return nil
+	}
+	for name, value := range entry.Vary {
+		if request.Header.Get(name) != value {
+			return nil
+		}
+	}
+	return entry
+}
+
+// save stores an entry
+func (c *Cache) save(key string, entry *cacheEntry) {
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	c.Storage.Set(key, content)
+}
+
+// store stores the response once its body is fully read, if the response can be stored
+func (c *Cache) store(key string, request *http.Request, response *http.Response, requestTime time.Time) {
+	if !c.storable(request, response) {
+		return
+	}
+	entry := &cacheEntry{
+		Status:       response.Status,
+		StatusCode:   response.StatusCode,
+		Header:       response.Header.Clone(),
+		RequestTime:  requestTime,
+		ResponseTime: time.Now(),
+	}
+	for _, value := range response.Header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = http.CanonicalHeaderKey(strings.TrimSpace(name)); name != "" {
+				if entry.Vary == nil {
+					entry.Vary = make(map[string]string)
+				}
+				entry.Vary[name] = request.Header.Get(name)
+			}
+		}
+	}
+	save := func(body []byte) {
+		entry.Body = body
+		c.save(key, entry)
+	}
+	if response.ContentLength == 0 {
+		save(nil)
+		return
+	}
+	response.Body = &cachingBody{ReadCloser: response.Body, limit: c.MaxEntrySize, save: save}
+}
+
+// storable tells whether the response to the request can be stored
+func (c *Cache) storable(request *http.Request, response *http.Response) bool {
+	control := parseCacheControl(response.Header)
+	if control.has("no-store") || response.StatusCode == http.StatusPartialContent {
+		return false
+	}
+	for _, value := range response.Header.Values("Vary") {
+		if strings.Contains(value, "*") {
+			return false
+		}
+	}
+	if c.Shared && control.has("private") {
+		return false
+	}
+	if !control.has("public") && !control.has("s-maxage") && !variesOnCredentials(request, response) {
+		return false
+	}
+	if control.has("public") || control.has("max-age") || (c.Shared && control.has("s-maxage")) ||
+		response.Header.Get("Expires") != "" {
+		return true
+	}
+	return cacheableStatus[response.StatusCode]
+}
+
+// credentialHeaders are the request headers identifying a user
+var credentialHeaders = []string{"Authorization", "Cookie"}
+
+// variesOnCredentials tells whether the response varies on every credential header of the request,
+// so that it is served only to the same credentials. The request of the response is checked too,
+// as the cookies of a jar are added while the request is sent, redirects included
+func variesOnCredentials(request *http.Request, response *http.Response) bool {
+	vary := strings.ToLower(strings.Join(response.Header.Values("Vary"), ","))
+	for _, name := range credentialHeaders {
+		credentialed := request.Header.Get(name) != ""
+		if response.Request != nil && response.Request.Header.Get(name) != "" {
+			credentialed = true
+		}
+		if credentialed && !varyHas(vary, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// varyHas tells whether a lower case Vary value names the header
+func varyHas(vary string, name string) bool {
+	for _, varied := range strings.Split(vary, ",") {
+		if strings.TrimSpace(varied) == strings.ToLower(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// age returns the current age of the entry
+func (e *cacheEntry) age(now time.Time) time.Duration {
+	apparentAge := time.Duration(0)
+	if date, err := http.ParseTime(e.Header.Get("Date")); err == nil && e.ResponseTime.After(date) {
+		apparentAge = e.ResponseTime.Sub(date)
+	}
+	ageValue, _ := strconv.ParseInt(e.Header.Get("Age"), 10, 64)
+	correctedAge := time.Duration(ageValue)*time.Second + e.ResponseTime.Sub(e.RequestTime)
+	if correctedAge > apparentAge {
+		apparentAge = correctedAge
+	}
+	return apparentAge + now.Sub(e.ResponseTime)
+}
+
+// freshness returns the freshness lifetime of the entry, from s-maxage for a shared cache, max-age, Expires,
+// or 10% of the time since Last-Modified for a status cacheable by default
+func (e *cacheEntry) freshness(shared bool) time.Duration {
+	control := parseCacheControl(e.Header)
+	if sMaxAge, ok := control.seconds("s-maxage"); ok && shared {
+		return sMaxAge
+	}
+	if maxAge, ok := control.seconds("max-age"); ok {
+		return maxAge
+	}
+	date, err := http.ParseTime(e.Header.Get("Date"))
+	if err != nil {
+		date = e.ResponseTime
+	}
+	if expiresValue := e.Header.Get("Expires"); expiresValue != "" {
+		// an invalid Expires, such as 0, means already expired
+		expires, err := http.ParseTime(expiresValue)
+		if err != nil || !expires.After(date) {
+			return 0
+		}
+		return expires.Sub(date)
+	}
+	if lastModified, err := http.ParseTime(e.Header.Get("Last-Modified")); err == nil && cacheableStatus[e.StatusCode] &&
+		date.After(lastModified) {
+		return date.Sub(lastModified) / 10
+	}
+	return 0
+}
+
+// response returns a response of the entry to the request
+func (e *cacheEntry) response(request *http.Request, age time.Duration, status CacheStatus) *http.Response {
+	header := e.Header.Clone()
+	header.Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+	return withCacheStatus(&http.Response{
+		Status:        e.Status,
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+	}, request, status)
+}
+
+// withCacheStatus sets the CacheStatus in the context of the request of a response, the request sent by default
+func withCacheStatus(response *http.Response, request *http.Request, status CacheStatus) *http.Response {
+	if response != nil {
+		if response.Request != nil {
+			request = response.Request
+		}
+		response.Request = request.WithContext(context.WithValue(request.Context(), cacheStatusKey{}, status))
+	}
+	return response
+}
+
+// cachingBody keeps the body read, which is saved once read to the end unless it exceeds the limit
+type cachingBody struct {
+	io.ReadCloser
+	buffer   bytes.Buffer
+	limit    int64
+	exceeded bool
+	save     func(body []byte)
+}
+
+// Read implements io.Reader
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if !b.exceeded {
+		b.buffer.Write(p[:n])
+		if b.limit > 0 && int64(b.buffer.Len()) > b.limit {
+			b.exceeded = true
+			b.buffer = bytes.Buffer{}
+		}
+	}
+	if err == io.EOF && !b.exceeded && b.save != nil {
+		b.save(b.buffer.Bytes())
+		b.save = nil
+	}
+	return n, err
+}
+
+// cacheControl are the directives of a Cache-Control header
+type cacheControl map[string]string
+
+// parseCacheControl parses the Cache-Control header
+func parseCacheControl(httpHeader http.Header) cacheControl {
+	control := make(cacheControl)
+	for _, value := range httpHeader.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, argument, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name != "" {
+				control[strings.ToLower(name)] = strings.Trim(argument, `"`)
+			}
+		}
+	}
+	return control
+}
+
+// has tells whether the directive is present
+func (c cacheControl) has(directive string) bool {
+	_, ok := c[directive]
+	return ok
+}
+
+// seconds returns the duration of a directive in seconds, false if it is missing or invalid
+func (c cacheControl) seconds(directive string) (time.Duration, bool) {
+	value, ok := c[directive]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
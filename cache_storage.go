@@ -0,0 +1,148 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CacheStorage stores the serialized entries of a Cache
+// The storage is best effort, an entry which can not be stored is simply missed by the next Get
+type CacheStorage interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, entry []byte)
+	Delete(key string)
+}
+
+// MemoryCacheStorage is a CacheStorage in memory, evicting the least recently used entries
+type MemoryCacheStorage struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	lru      *list.List
+	items    map[string]*list.Element
+}
+
+// memoryCacheItem is an entry of a MemoryCacheStorage
+type memoryCacheItem struct {
+	key   string
+	entry []byte
+}
+
+// NewMemoryCacheStorage returns a MemoryCacheStorage holding up to maxBytes of entries, 0 means no limit
+func NewMemoryCacheStorage(maxBytes int64) *MemoryCacheStorage {
+	return &MemoryCacheStorage{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Get implements CacheStorage
+func (s *MemoryCacheStorage) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	element, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	s.lru.MoveToFront(element)
+	return element.Value.(*memoryCacheItem).entry, true
+}
+
+// Set implements CacheStorage, an entry larger than the limit is not stored
+func (s *MemoryCacheStorage) Set(key string, entry []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(key)
+	if s.maxBytes > 0 && int64(len(entry)) > s.maxBytes {
+		return
+	}
+	s.items[key] = s.lru.PushFront(&memoryCacheItem{key: key, entry: entry})
+	s.size += int64(len(entry))
+	for s.maxBytes > 0 && s.size > s.maxBytes {
+		s.remove(s.lru.Back().Value.(*memoryCacheItem).key)
+	}
+}
+
+// Delete implements CacheStorage
+func (s *MemoryCacheStorage) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(key)
+}
+
+// Len returns the number of entries
+func (s *MemoryCacheStorage) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
+
+// remove removes an entry, the lock must be held
+func (s *MemoryCacheStorage) remove(key string) {
+	element, ok := s.items[key]
+	if !ok {
+		return
+	}
+	s.lru.Remove(element)
+	delete(s.items, key)
+	s.size -= int64(len(element.Value.(*memoryCacheItem).entry))
+}
+
+// DiskCacheStorage is a CacheStorage keeping an entry per file in a directory
+type DiskCacheStorage struct {
+	dir string
+}
+
+// NewDiskCacheStorage returns a DiskCacheStorage in dir, which is created if missing
+func NewDiskCacheStorage(dir string) (*DiskCacheStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DiskCacheStorage{dir: dir}, nil
+}
+
+// Get implements CacheStorage
+func (s *DiskCacheStorage) Get(key string) ([]byte, bool) {
+	entry, err := os.ReadFile(s.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return entry, true
+}
+
+// Set implements CacheStorage, the entry is written to a temporary file renamed once complete
+func (s *DiskCacheStorage) Set(key string, entry []byte) {
+	file, err := os.CreateTemp(s.dir, "tmp-")
+	if err != nil {
+		return
+	}
+	_, err = file.Write(entry)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), s.path(key))
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+}
+
+// Delete implements CacheStorage
+func (s *DiskCacheStorage) Delete(key string) {
+	os.Remove(s.path(key))
+}
+
+// path returns the file of an entry, named after the hash of the key
+func (s *DiskCacheStorage) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,234 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient_test
+
+import (
+	"github.com/panwenbin/ghttpclient"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newCacheServer returns a server answering with the headers, or with a 304 Not Modified when the ETag matches,
+// and the number of requests received. The body is the number of the request
+func newCacheServer(t *testing.T, headers map[string]string) (*httptest.Server, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := atomic.AddInt32(&calls, 1)
+		for key, value := range headers {
+			w.Header().Set(key, value)
+		}
+		if etag := headers["ETag"]; etag != "" && r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(strconv.Itoa(int(call)) + r.Header.Get("Accept-Language")))
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+// getCached sends a GET request through the cache and returns the body and the cache status
+func getCached(t *testing.T, cache *ghttpclient.Cache, url string, headers ...string) (string, ghttpclient.CacheStatus) {
+	client := ghttpclient.NewClient().Url(url).Cache(cache)
+	for i := 0; i+1 < len(headers); i += 2 {
+		client.Header(headers[i], headers[i+1])
+	}
+	body, err := client.Get().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body), client.CacheStatus()
+}
+
+func TestCacheHit(t *testing.T) {
+	server, calls := newCacheServer(t, map[string]string{"Cache-Control": "max-age=60"})
+	cache := ghttpclient.NewCache(ghttpclient.NewMemoryCacheStorage(0))
+
+	if body, status := getCached(t, cache, server.URL); body != "1" || status != ghttpclient.CacheMiss {
+		t.Errorf("expect 1 and miss, got %s and %s", body, status)
+	}
+	if body, status := getCached(t, cache, server.URL); body != "1" || status != ghttpclient.CacheHit {
+		t.Errorf("expect 1 and hit, got %s and %s", body, status)
+	}
+	if body, status := getCached(t, cache, server.URL, "Cache-Control", "no-cache"); body != "2" || status != ghttpclient.CacheMiss {
+		t.Errorf("expect a no-cache request to reach the server, got %s and %s", body, status)
+	}
+
+	_, err := ghttpclient.NewClient().Url(server.URL).Cache(cache).Post().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, status := getCached(t, cache, server.URL); body != "4" || status != ghttpclient.CacheMiss {
+		t.Errorf("expect the entry to be invalidated by a POST, got %s and %s", body, status)
+	}
+	if atomic.LoadInt32(calls) != 4 {
+		t.Errorf("expect 4 requests, got %d", atomic.LoadInt32(calls))
+	}
+}
+
+func TestCacheRevalidate(t *testing.T) {
+	server, calls := newCacheServer(t, map[string]string{"Cache-Control": "max-age=0, must-revalidate", "ETag": `"v1"`})
+	cache := ghttpclient.NewCache(ghttpclient.NewMemoryCacheStorage(0))
+
+	getCached(t, cache, server.URL)
+	for i := 0; i < 2; i++ {
+		if body, status := getCached(t, cache, server.URL); body != "1" || status != ghttpclient.CacheRevalidated {
+			t.Errorf("expect 1 and revalidated, got %s and %s", body, status)
+		}
+	}
+	if atomic.LoadInt32(calls) != 3 {
+		t.Errorf("expect 3 requests, got %d", atomic.LoadInt32(calls))
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	server, calls := newCacheServer(t, map[string]string{"Cache-Control": "max-age=10, stale-while-revalidate=60", "Age": "20"})
+	cache := ghttpclient.NewCache(ghttpclient.NewMemoryCacheStorage(0))
+
+	getCached(t, cache, server.URL)
+	if body, status := getCached(t, cache, server.URL); body != "1" || status != ghttpclient.CacheStale {
+		t.Errorf("expect 1 and stale, got %s and %s", body, status)
+	}
+	for i := 0; i < 100 && atomic.LoadInt32(calls) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt32(calls) != 2 {
+		t.Fatalf("expect a background revalidation, got %d requests", atomic.LoadInt32(calls))
+	}
+	for i := 0; i < 100; i++ {
+		if body, _ := getCached(t, cache, server.URL); body == "2" || body == "3" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("expect the revalidated response to be stored")
+}
+
+func TestCacheNotStored(t *testing.T) {
+	cases := []map[string]string{
+		{"Cache-Control": "no-store, max-age=60"},
+		{"Cache-Control": "max-age=60", "Vary": "*"},
+		{"Expires": "0"},
+	}
+	for _, headers := range cases {
+		server, _ := newCacheServer(t, headers)
+		cache := ghttpclient.NewCache(ghttpclient.NewMemoryCacheStorage(0))
+		getCached(t, cache, server.URL)
+		if body, status := getCached(t, cache, server.URL); body != "2" || status != ghttpclient.CacheMiss {
+			t.Errorf("%v: expect 2 and miss, got %s and %s", headers, body, status)
+		}
+	}
+
+	server, _ := newCacheServer(t, map[string]string{"Cache-Control": "private, max-age=60"})
+	cache := ghttpclient.NewCache(ghttpclient.NewMemoryCacheStorage(0))
+	cache.Shared = true
+	getCached(t, cache, server.URL)
+	if _, status := getCached(t, cache, server.URL); status != ghttpclient.CacheMiss {
+		t.Errorf("expect a private response not to be stored by a shared cache, got %s", status)
+	}
+}
+
+func TestCacheCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		if r.URL.Path == "/vary" {
+			w.Header().Set("Vary", "Authorization")
+		}
+		w.Write([]byte(r.Header.Get("Authorization") + r.Header.Get("Cookie")))
+	}))
+	defer server.Close()
+	cache := ghttpclient.NewCache(ghttpclient.NewMemoryCacheStorage(0))
+
+	for _, path := range []string{"/", "/vary"} {
+		getCached(t, cache, server.URL+path, "Authorization", "alice")
+		if body, _ := getCached(t, cache, server.URL+path, "Authorization", "bob"); body != "bob" {
+			t.Errorf("%s: expect the response of bob, got %s", path, body)
+		}
+	}
+	if body, status := getCached(t, cache, server.URL+"/vary", "Authorization", "bob"); body != "bob" || status != ghttpclient.CacheHit {
+		t.Errorf("expect a response varying on Authorization to be stored, got %s and %s", body, status)
+	}
+
+	getCached(t, cache, server.URL+"/cookie", "Cookie", "user=alice")
+	if body, _ := getCached(t, cache, server.URL+"/cookie", "Cookie", "user=bob"); body != "user=bob" {
+		t.Errorf("expect the response of bob, got %s", body)
+	}
+}
+
+func TestCacheStatusUpstreamHeader(t *testing.T) {
+	server, _ := newCacheServer(t, map[string]string{"Cache-Control": "max-age=60", "X-Cache-Status": "HIT"})
+	cache := ghttpclient.NewCache(ghttpclient.NewMemoryCacheStorage(0))
+
+	client := ghttpclient.NewClient().Url(server.URL).Cache(cache)
+	response, err := client.Get().Response()
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if client.CacheStatus() != ghttpclient.CacheMiss || response.Header.Get("X-Cache-Status") != "HIT" {
+		t.Errorf("expect miss and the header of the server, got %s and %s", client.CacheStatus(), response.Header.Get("X-Cache-Status"))
+	}
+
+	client = ghttpclient.NewClient().Url(server.URL)
+	if _, err := client.Get().ReadBodyClose(); err != nil {
+		t.Fatal(err)
+	}
+	if client.CacheStatus() != "" {
+		t.Errorf("expect no cache status without a Cache, got %s", client.CacheStatus())
+	}
+}
+
+func TestCacheVary(t *testing.T) {
+	server, _ := newCacheServer(t, map[string]string{"Cache-Control": "max-age=60", "Vary": "Accept-Language"})
+	cache := ghttpclient.NewCache(ghttpclient.NewMemoryCacheStorage(0))
+
+	getCached(t, cache, server.URL, "Accept-Language", "en")
+	if body, status := getCached(t, cache, server.URL, "Accept-Language", "en"); body != "1en" || status != ghttpclient.CacheHit {
+		t.Errorf("expect 1en and hit, got %s and %s", body, status)
+	}
+	if body, status := getCached(t, cache, server.URL, "Accept-Language", "zh"); body != "2zh" || status != ghttpclient.CacheMiss {
+		t.Errorf("expect 2zh and miss, got %s and %s", body, status)
+	}
+}
+
+func TestCacheExpires(t *testing.T) {
+	expires := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	server, _ := newCacheServer(t, map[string]string{"Expires": expires})
+	storage, err := ghttpclient.NewDiskCacheStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getCached(t, ghttpclient.NewCache(storage), server.URL)
+	if body, status := getCached(t, ghttpclient.NewCache(storage), server.URL); body != "1" || status != ghttpclient.CacheHit {
+		t.Errorf("expect 1 and hit from the disk, got %s and %s", body, status)
+	}
+}
+
+func TestMemoryCacheStorage(t *testing.T) {
+	storage := ghttpclient.NewMemoryCacheStorage(10)
+	storage.Set("a", []byte("aaaa"))
+	storage.Set("b", []byte("bbbb"))
+	storage.Get("a")
+	storage.Set("c", []byte("cccc"))
+	storage.Set("d", []byte(strings.Repeat("d", 11)))
+
+	if _, ok := storage.Get("b"); ok {
+		t.Error("expect the least recently used entry to be evicted")
+	}
+	if entry, ok := storage.Get("a"); !ok || string(entry) != "aaaa" {
+		t.Errorf("expect aaaa, got %s", entry)
+	}
+	if _, ok := storage.Get("d"); ok {
+		t.Error("expect an entry larger than the limit not to be stored")
+	}
+	if storage.Len() != 2 {
+		t.Errorf("expect 2 entries, got %d", storage.Len())
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/panwenbin/ghttpclient/header"
+	"sync"
+)
+
+// ErrUnknownCodec is returned when a body is encoded by a codec which is not registered
+var ErrUnknownCodec = errors.New("unknown codec")
+
+// Encoder encodes Go values as request bodies
+type Encoder interface {
+	// ContentType returns the Content-Type of the encoded bodies
+	ContentType() string
+	Encode(v any) ([]byte, error)
+}
+
+// encoderFunc is an Encoder made of a content type and a function
+type encoderFunc struct {
+	contentType string
+	encode      func(v any) ([]byte, error)
+}
+
+// NewEncoder returns an Encoder encoding bodies of the content type with the function
+func NewEncoder(contentType string, encode func(v any) ([]byte, error)) Encoder {
+	return &encoderFunc{contentType: contentType, encode: encode}
+}
+
+// ContentType implements Encoder
+func (e *encoderFunc) ContentType() string {
+	return e.contentType
+}
+
+// Encode implements Encoder
+func (e *encoderFunc) Encode(v any) ([]byte, error) {
+	return e.encode(v)
+}
+
+var (
+	encodersMu sync.RWMutex
+	encoders   = map[string]Encoder{
+		"json": NewEncoder(header.CONTENT_TYPE_JSON, json.Marshal),
+		"xml":  NewEncoder(header.CONTENT_TYPE_XML, xml.Marshal),
+		"form": NewEncoder(header.CONTENT_TYPE_FORM_URLENCODED, func(v any) ([]byte, error) {
+			values, err := EncodeValues(v, "form")
+			if err != nil {
+				return nil, err
+			}
+			return []byte(values.Encode()), nil
+		}),
+	}
+)
+
+// RegisterEncoder registers an encoder under a name, such as "msgpack" or "protobuf", for Encode
+// The built-in encoders "json", "xml" and "form" can be replaced
+func RegisterEncoder(name string, encoder Encoder) {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+	encoders[name] = encoder
+}
+
+// LookupEncoder returns the encoder registered under the name
+func LookupEncoder(name string) (Encoder, bool) {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	encoder, ok := encoders[name]
+	return encoder, ok
+}
+
+// Encode sets the body to v encoded by the encoder registered under the name, and sets the Content-Type header
+// The body can be replayed for retries, an encoding error is returned by the next action
+func (g *GHttpClient) Encode(name string, v any) *GHttpClient {
+	encoder, ok := LookupEncoder(name)
+	if !ok {
+		g.setOptionErr(fmt.Errorf("%w: %s", ErrUnknownCodec, name))
+		return g
+	}
+	body, err := encoder.Encode(v)
+	if err != nil {
+		g.setOptionErr(fmt.Errorf("encode %s body: %w", name, err))
+		return g
+	}
+	g.Body(bytes.NewReader(body))
+	g.header.ContentType(encoder.ContentType())
+	return g
+}
+
+// JSON sets the body to v encoded as a json
+func (g *GHttpClient) JSON(v any) *GHttpClient {
+	return g.Encode("json", v)
+}
+
+// XML sets the body to v encoded as a xml
+func (g *GHttpClient) XML(v any) *GHttpClient {
+	return g.Encode("xml", v)
+}
+
+// Form sets the body to v encoded as an url encoded form, see EncodeValues for the form tags
+func (g *GHttpClient) Form(v any) *GHttpClient {
+	return g.Encode("form", v)
+}
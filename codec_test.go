@@ -0,0 +1,108 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient_test
+
+import (
+	"errors"
+	"github.com/panwenbin/ghttpclient"
+	"github.com/panwenbin/ghttpclient/header"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type point struct {
+	X int `json:"x" xml:"x"`
+	Y int `json:"y" xml:"y"`
+}
+
+func TestJSONAndXML(t *testing.T) {
+	server := newFailingServer(t, failFirst(1), http.HandlerFunc(echo))
+
+	policy := ghttpclient.NewRetryPolicy()
+	policy.MinBackoff = time.Millisecond
+	body, err := ghttpclient.NewClient().Url(server.URL + "/request").Retry(policy).JSON(point{1, 2}).Put().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != header.CONTENT_TYPE_JSON+`||{"x":1,"y":2}` {
+		t.Errorf("expect the json body to be replayed, got %s", body)
+	}
+
+	body, err = ghttpclient.NewClient().Url(server.URL + "/request").XML(point{1, 2}).Post().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != header.CONTENT_TYPE_XML+"||<point><x>1</x><y>2</y></point>" {
+		t.Errorf("expect a xml body, got %s", body)
+	}
+
+	_, err = ghttpclient.NewClient().Url(server.URL).JSON(func() {}).Post().Response()
+	if err == nil || !strings.Contains(err.Error(), "encode json body") {
+		t.Errorf("expect an encoding error, got %v", err)
+	}
+}
+
+type Paging struct {
+	Page int `url:"page" form:"page"`
+}
+
+type search struct {
+	Paging
+	Keyword string     `url:"q" form:"keyword"`
+	Tags    []string   `url:"tag,omitempty" form:"tag"`
+	Since   *time.Time `url:"since,omitempty"`
+	Secret  string     `url:"-" form:"-"`
+	Exact   bool
+}
+
+func TestFormAndQuery(t *testing.T) {
+	server := newEchoServer(t)
+	since := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	s := &search{Paging: Paging{Page: 2}, Keyword: "go http", Tags: []string{"a", "b"}, Since: &since, Secret: "secret"}
+
+	body, err := ghttpclient.NewClient().Url(server.URL + "/request").Form(s).Post().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := header.CONTENT_TYPE_FORM_URLENCODED + "||Exact=false&Since=2019-07-01T00%3A00%3A00Z&keyword=go+http&page=2&tag=a&tag=b"
+	if string(body) != expect {
+		t.Errorf("expect %s, got %s", expect, body)
+	}
+
+	body, err = ghttpclient.NewTemplate().BaseUrl(server.URL).Query(map[string]string{"lang": "en"}).R().
+		Url("/request?v=1").Query(&search{Keyword: "go"}).Get().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "|v=1&Exact=false&lang=en&page=0&q=go|" {
+		t.Errorf("expect |v=1&Exact=false&lang=en&page=0&q=go|, got %s", body)
+	}
+
+	_, err = ghttpclient.NewClient().Url(server.URL).Query(42).Get().Response()
+	if err == nil {
+		t.Error("expect an error for a query which is not a struct or a map")
+	}
+}
+
+func TestRegisterEncoder(t *testing.T) {
+	server := newEchoServer(t)
+	ghttpclient.RegisterEncoder("text", ghttpclient.NewEncoder("text/plain", func(v any) ([]byte, error) {
+		return []byte(v.(string)), nil
+	}))
+
+	body, err := ghttpclient.NewClient().Url(server.URL+"/request").Encode("text", "ghttpclient").Post().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "text/plain||ghttpclient" {
+		t.Errorf("expect text/plain||ghttpclient, got %s", body)
+	}
+
+	_, err = ghttpclient.NewClient().Url(server.URL).Encode("msgpack", 42).Post().Response()
+	if !errors.Is(err, ghttpclient.ErrUnknownCodec) {
+		t.Errorf("expect an unknown codec error, got %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// DefaultCompression is the level of CompressBody choosing the default level of the algorithm
+const DefaultCompression = flate.DefaultCompression
+
+// DefaultCompressMinSize is the body size in bytes below which CompressBody sends the body as is
+var DefaultCompressMinSize int64 = 1024
+
+// Compressor returns a writer compressing to w at a level, DefaultCompression or a level of the algorithm
+type Compressor func(w io.Writer, level int) (io.WriteCloser, error)
+
+var (
+	compressorsMu sync.RWMutex
+	compressors   = map[string]Compressor{
+		"gzip": func(w io.Writer, level int) (io.WriteCloser, error) {
+			return gzip.NewWriterLevel(w, level)
+		},
+		"deflate": func(w io.Writer, level int) (io.WriteCloser, error) {
+			return zlib.NewWriterLevel(w, level)
+		},
+		"br": func(w io.Writer, level int) (io.WriteCloser, error) {
+			if level == DefaultCompression {
+				level = brotli.DefaultCompression
+			}
+			return brotli.NewWriterLevel(w, level), nil
+		},
+		"zstd": func(w io.Writer, level int) (io.WriteCloser, error) {
+			if level == DefaultCompression {
+				return zstd.NewWriter(w)
+			}
+			return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		},
+	}
+)
+
+// RegisterCompressor registers a compressor for a content coding, used by CompressBody
+// The built-in compressors "gzip", "deflate", "br" and "zstd" can be replaced
+func RegisterCompressor(coding string, compressor Compressor) {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+	compressors[normalizeCoding(coding)] = compressor
+}
+
+// LookupCompressor returns the compressor registered for the content coding
+func LookupCompressor(coding string) (Compressor, bool) {
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+	compressor, ok := compressors[normalizeCoding(coding)]
+	return compressor, ok
+}
+
+// compression compresses request bodies
+type compression struct {
+	coding     string
+	level      int
+	compressor Compressor
+}
+
+// CompressBody compresses the request body with a content coding, "gzip", "deflate", "br" or "zstd", at a level,
+// and sets the Content-Encoding header. The body is compressed while it is sent, a body smaller than
+// the minimum size, DefaultCompressMinSize by default, is sent as is
+// An unknown coding or an invalid level is returned by the next action
+func (g *GHttpClient) CompressBody(coding string, level int) *GHttpClient {
+	compressor, ok := LookupCompressor(coding)
+	if !ok {
+		g.setOptionErr(&UnknownEncodingError{Encoding: coding})
+		return g
+	}
+	writer, err := compressor(ioutil.Discard, level)
+	if err != nil {
+		g.setOptionErr(err)
+		return g
+	}
+	writer.Close()
+	g.compression = &compression{coding: normalizeCoding(coding), level: level, compressor: compressor}
+	return g
+}
+
+// CompressMinSize sets the body size in bytes below which CompressBody sends the body as is, 0 compresses every body
+func (g *GHttpClient) CompressMinSize(n int64) *GHttpClient {
+	g.compressMin = &n
+	return g
+}
+
+// compressRequest replaces the body of the request with its compressed stream, unless the body is smaller than minSize
+// A replayable body stays replayable
+func (c *compression) compressRequest(request *http.Request, minSize int64) error {
+	if request.Body == nil || request.Body == http.NoBody {
+		return nil
+	}
+	body := request.Body
+	if request.ContentLength > 0 {
+		if request.ContentLength < minSize {
+			return nil
+		}
+	} else {
+		// the size is unknown, the beginning of the body tells whether it is smaller than minSize
+		prefix, err := ioutil.ReadAll(io.LimitReader(request.Body, minSize))
+		if err != nil {
+			request.Body.Close()
+			return err
+		}
+		if int64(len(prefix)) < minSize {
+			request.Body.Close()
+			request.Body = ioutil.NopCloser(bytes.NewReader(prefix))
+			request.ContentLength = int64(len(prefix))
+			return nil
+		}
+		body = &multiReadCloser{Reader: io.MultiReader(bytes.NewReader(prefix), request.Body), Closer: request.Body}
+	}
+
+	request.Body = c.compress(body)
+	if getBody := request.GetBody; getBody != nil {
+		request.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return c.compress(body), nil
+		}
+	}
+	request.ContentLength = -1
+	request.Header.Del("Content-Length")
+	request.Header.Set("Content-Encoding", c.coding)
+	return nil
+}
+
+// compress returns a reader of the compressed body, the body is compressed by a goroutine started by the first Read
+func (c *compression) compress(body io.ReadCloser) io.ReadCloser {
+	reader, writer := io.Pipe()
+	return &compressedBody{body: body, pipeBody: &pipeBody{
+		PipeReader: reader,
+		start: func() {
+			defer body.Close()
+			compressor, err := c.compressor(writer, c.level)
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+			if _, err := io.Copy(compressor, body); err != nil {
+				compressor.Close()
+				writer.CloseWithError(err)
+				return
+			}
+			writer.CloseWithError(compressor.Close())
+		},
+	}}
+}
+
+// compressedBody is the compressed stream of a body
+type compressedBody struct {
+	*pipeBody
+	body io.Closer
+}
+
+// Close implements io.Closer, the body is closed at once if the compression has not started
+func (b *compressedBody) Close() error {
+	b.once.Do(func() {
+		b.body.Close()
+	})
+	return b.PipeReader.Close()
+}
+
+// compressMinSize returns the minimum size of the compressed bodies
+func (g *GHttpClient) compressMinSize() int64 {
+	if g.compressMin != nil {
+		return *g.compressMin
+	}
+	return DefaultCompressMinSize
+}
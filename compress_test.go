@@ -0,0 +1,125 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient_test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/panwenbin/ghttpclient"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newCompressedEchoServer returns a server echoing the request body with its Content-Encoding,
+// and the size of the last request body received. The requests for which fail returns true get a 503
+func newCompressedEchoServer(t *testing.T, fail func() bool) (*httptest.Server, *int64) {
+	var received int64
+	server := newFailingServer(t, fail, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		atomic.StoreInt64(&received, int64(len(body)))
+		w.Header().Set("Content-Encoding", r.Header.Get("Content-Encoding"))
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body)
+	}))
+	return server, &received
+}
+
+func TestCompressBody(t *testing.T) {
+	content := strings.Repeat("ghttpclient", 1000)
+	server, received := newCompressedEchoServer(t, nil)
+
+	for _, coding := range []string{"gzip", "deflate", "br", "zstd"} {
+		for _, level := range []int{ghttpclient.DefaultCompression, 1} {
+			response, err := ghttpclient.NewClient().Url(server.URL).AcceptEncoding().
+				Body(io.MultiReader(strings.NewReader(content))).CompressBody(coding, level).Post().Response()
+			if err != nil {
+				t.Fatalf("%s: %v", coding, err)
+			}
+			if response.Header.Get("Content-Encoding") != coding {
+				t.Errorf("expect %s, got %s", coding, response.Header.Get("Content-Encoding"))
+			}
+			body, err := ghttpclient.ReadBodyClose(response)
+			if err != nil || string(body) != content {
+				t.Errorf("%s: expect the body to be decoded, got %d bytes and %v", coding, len(body), err)
+			}
+			if *received >= int64(len(content)) {
+				t.Errorf("%s: expect a compressed body, got %d bytes", coding, *received)
+			}
+		}
+	}
+}
+
+func TestCompressBodyMinSize(t *testing.T) {
+	server, received := newCompressedEchoServer(t, nil)
+
+	for _, body := range []io.Reader{strings.NewReader("ghttpclient"), io.MultiReader(strings.NewReader("ghttpclient"))} {
+		response, err := ghttpclient.NewClient().Url(server.URL).Body(body).CompressBody("gzip", ghttpclient.DefaultCompression).
+			Post().Response()
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.Header.Get("Content-Encoding") != "" || *received != int64(len("ghttpclient")) {
+			t.Errorf("expect a body below the minimum size to be sent as is, got %d bytes", *received)
+		}
+	}
+
+	body, err := ghttpclient.NewClient().Url(server.URL).Body(strings.NewReader("ghttpclient")).
+		CompressBody("gzip", ghttpclient.DefaultCompression).CompressMinSize(0).Post().ReadBodyClose()
+	if err != nil || string(body) != "ghttpclient" {
+		t.Errorf("expect ghttpclient, got %s and %v", body, err)
+	}
+	if *received == int64(len("ghttpclient")) {
+		t.Error("expect the body to be compressed without minimum size")
+	}
+}
+
+func TestCompressBodyRetry(t *testing.T) {
+	content := strings.Repeat("ghttpclient", 1000)
+	server, _ := newCompressedEchoServer(t, failFirst(1))
+	policy := ghttpclient.NewRetryPolicy()
+	policy.MinBackoff = time.Millisecond
+
+	body, err := ghttpclient.NewClient().Url(server.URL).Retry(policy).Header("Accept-Encoding", "zstd").
+		Body(bytes.NewReader([]byte(content))).CompressBody("zstd", ghttpclient.DefaultCompression).Put().ReadBodyClose()
+	if err != nil || string(body) != content {
+		t.Errorf("expect the compressed body to be replayed, got %d bytes and %v", len(body), err)
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read failure")
+}
+
+func TestCompressBodyErrors(t *testing.T) {
+	server, _ := newCompressedEchoServer(t, nil)
+
+	_, err := ghttpclient.NewClient().Url(server.URL).Body(strings.NewReader("ghttpclient")).
+		CompressBody("lzma", ghttpclient.DefaultCompression).Post().Response()
+	var unknown *ghttpclient.UnknownEncodingError
+	if !errors.As(err, &unknown) || unknown.Encoding != "lzma" {
+		t.Errorf("expect an unknown lzma coding error, got %v", err)
+	}
+
+	_, err = ghttpclient.NewClient().Url(server.URL).Body(strings.NewReader("ghttpclient")).
+		CompressBody("gzip", 42).Post().Response()
+	if err == nil {
+		t.Error("expect an invalid level error")
+	}
+
+	_, err = ghttpclient.NewClient().Url(server.URL).Body(io.MultiReader(strings.NewReader(strings.Repeat("ghttpclient", 1000)), failingReader{})).
+		CompressBody("gzip", ghttpclient.DefaultCompression).Post().Response()
+	if err == nil || !strings.Contains(err.Error(), "read failure") {
+		t.Errorf("expect the read failure, got %v", err)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// UnknownEncodingError is returned for a content coding without registered decompressor when a response body is decoded,
+// or without registered compressor when CompressBody compresses a request body
+type UnknownEncodingError struct {
+	Encoding string
+}
+
+// Error implements the error interface
+func (e *UnknownEncodingError) Error() string {
+	return fmt.Sprintf("unknown content coding %q", e.Encoding)
+}
+
+// Decompressor returns a reader decoding a body of its content coding
+type Decompressor func(r io.Reader) (io.ReadCloser, error)
+
+var (
+	decompressorsMu sync.RWMutex
+	// decompressorCodings keeps the order of registration for Accept-Encoding
+	decompressorCodings = []string{"gzip", "deflate", "br", "zstd"}
+	decompressors       = map[string]Decompressor{
+		"gzip": func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+		"deflate": decompressDeflate,
+		"br": func(r io.Reader) (io.ReadCloser, error) {
+			return ioutil.NopCloser(brotli.NewReader(r)), nil
+		},
+		"zstd": func(r io.Reader) (io.ReadCloser, error) {
+			// the window of 8 MB is the limit of zstd in HTTP, RFC 9659, one goroutine decodes each response
+			decoder, err := zstd.NewReader(r, zstd.WithDecoderMaxWindow(8<<20), zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			return decoder.IOReadCloser(), nil
+		},
+	}
+)
+
+// RegisterDecompressor registers a decompressor for a content coding, such as "lz4"
+// The built-in decompressors "gzip", "deflate", "br" and "zstd" can be replaced
+func RegisterDecompressor(coding string, decompressor Decompressor) {
+	coding = normalizeCoding(coding)
+	decompressorsMu.Lock()
+	defer decompressorsMu.Unlock()
+	if _, ok := decompressors[coding]; !ok {
+		decompressorCodings = append(decompressorCodings, coding)
+	}
+	decompressors[coding] = decompressor
+}
+
+// LookupDecompressor returns the decompressor registered for the content coding
+func LookupDecompressor(coding string) (Decompressor, bool) {
+	decompressorsMu.RLock()
+	defer decompressorsMu.RUnlock()
+	decompressor, ok := decompressors[normalizeCoding(coding)]
+	return decompressor, ok
+}
+
+// AcceptEncoding returns an Accept-Encoding value listing the registered content codings, such as "gzip, deflate, br, zstd"
+func AcceptEncoding() string {
+	decompressorsMu.RLock()
+	defer decompressorsMu.RUnlock()
+	return strings.Join(decompressorCodings, ", ")
+}
+
+// AcceptEncoding sets the Accept-Encoding header to the registered content codings
+// The response body is then decoded by ReadBodyClose, Stream and the other body helpers, not in Response
+func (g *GHttpClient) AcceptEncoding() *GHttpClient {
+	return g.Header("Accept-Encoding", AcceptEncoding())
+}
+
+// NoAcceptEncoding sets whether to leave the Accept-Encoding header to the transport, which accepts only gzip
+// By default, a request without Accept-Encoding nor Range header accepts the registered content codings,
+// and its response is decoded transparently, as the transport does for gzip
+func (g *GHttpClient) NoAcceptEncoding(disable bool) *GHttpClient {
+	g.noAcceptEnc = disable
+	return g
+}
+
+// acceptEncoding sets the Accept-Encoding header of a request which has none, it tells whether it is set
+func (g *GHttpClient) acceptEncoding(request *http.Request) bool {
+	if g.noAcceptEnc || request.Header.Get("Accept-Encoding") != "" || request.Header.Get("Range") != "" {
+		return false
+	}
+	request.Header.Set("Accept-Encoding", AcceptEncoding())
+	return true
+}
+
+// decodeResponse replaces the body of the response with its decoded stream, unless a coding is unknown
+func decodeResponse(response *http.Response) {
+	codings := contentCodings(response.Header)
+	if len(codings) == 0 || response.Body == nil || response.Body == http.NoBody {
+		return
+	}
+	for _, coding := range codings {
+		if _, ok := LookupDecompressor(coding); !ok {
+			return
+		}
+	}
+	response.Body = &decodedBody{body: response.Body, header: response.Header.Clone()}
+	response.Header.Del("Content-Encoding")
+	response.Header.Del("Content-Length")
+	response.ContentLength = -1
+	response.Uncompressed = true
+}
+
+// decodedBody decodes a body, the decoders are created by the first Read
+type decodedBody struct {
+	body    io.ReadCloser
+	header  http.Header
+	once    sync.Once
+	reader  io.Reader
+	closers []io.Closer
+	err     error
+}
+
+// Read implements io.Reader
+func (b *decodedBody) Read(p []byte) (int, error) {
+	b.once.Do(func() {
+		b.reader, b.closers, b.err = decompress(b.body, b.header)
+	})
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.reader.Read(p)
+}
+
+// Close implements io.Closer
+func (b *decodedBody) Close() error {
+	closeAll(b.closers)
+	return b.body.Close()
+}
+
+// normalizeCoding returns the lower case coding, with the x-gzip alias of gzip
+func normalizeCoding(coding string) string {
+	coding = strings.ToLower(strings.TrimSpace(coding))
+	if coding == "x-gzip" {
+		return "gzip"
+	}
+	return coding
+}
+
+// contentCodings returns the content codings of a header in the order they were applied, without identity
+func contentCodings(httpHeader http.Header) []string {
+	var codings []string
+	for _, value := range httpHeader.Values("Content-Encoding") {
+		for _, coding := range strings.Split(value, ",") {
+			coding = normalizeCoding(coding)
+			if coding != "" && coding != "identity" {
+				codings = append(codings, coding)
+			}
+		}
+	}
+	return codings
+}
+
+// decompress decodes r from its content codings, the last applied coding is decoded first
+// It returns the decoded reader and the decoders to close
+func decompress(r io.Reader, httpHeader http.Header) (io.Reader, []io.Closer, error) {
+	codings := contentCodings(httpHeader)
+	var closers []io.Closer
+	for i := len(codings) - 1; i >= 0; i-- {
+		decompressor, ok := LookupDecompressor(codings[i])
+		if !ok {
+			closeAll(closers)
+			return nil, nil, &UnknownEncodingError{Encoding: codings[i]}
+		}
+		decoded, err := decompressor(r)
+		if err != nil {
+			closeAll(closers)
+			return nil, nil, err
+		}
+		r = decoded
+		closers = append(closers, decoded)
+	}
+	return r, closers, nil
+}
+
+// closeAll closes the closers in reverse order
+func closeAll(closers []io.Closer) error {
+	var err error
+	for i := len(closers) - 1; i >= 0; i-- {
+		if closeErr := closers[i].Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// decompressDeflate decodes a zlib stream as specified for the deflate coding,
+// or a raw deflate stream as sent by some servers
+func decompressDeflate(r io.Reader) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(r)
+	head, err := buffered.Peek(2)
+	if err == nil && head[0]&0x0f == 8 && (uint16(head[0])<<8|uint16(head[1]))%31 == 0 {
+		return zlib.NewReader(buffered)
+	}
+	return flate.NewReader(buffered), nil
+}
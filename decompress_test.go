@@ -0,0 +1,167 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/panwenbin/ghttpclient"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// compress encodes content with the codings in the order they are listed
+func compress(t *testing.T, content []byte, codings ...string) []byte {
+	for _, coding := range codings {
+		buffer := &bytes.Buffer{}
+		var w io.WriteCloser
+		switch coding {
+		case "gzip":
+			w = gzip.NewWriter(buffer)
+		case "deflate":
+			w = zlib.NewWriter(buffer)
+		case "raw-deflate":
+			w, _ = flate.NewWriter(buffer, flate.DefaultCompression)
+		case "br":
+			w = brotli.NewWriter(buffer)
+		case "zstd":
+			w, _ = zstd.NewWriter(buffer)
+		default:
+			t.Fatalf("unexpected coding %s", coding)
+		}
+		w.Write(content)
+		w.Close()
+		content = buffer.Bytes()
+	}
+	return content
+}
+
+func TestDecompress(t *testing.T) {
+	content := []byte(strings.Repeat("ghttpclient", 1000))
+	var acceptEncoding string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+		codings := strings.Split(r.URL.Query().Get("codings"), ",")
+		w.Header().Set("Content-Encoding", strings.Replace(r.URL.Query().Get("codings"), ",", ", ", -1))
+		w.Write(compress(t, content, codings...))
+	}))
+	defer server.Close()
+
+	for _, codings := range []string{"gzip", "deflate", "br", "zstd", "gzip,br", "zstd,deflate,gzip"} {
+		body, err := ghttpclient.NewClient().Url(server.URL + "?codings=" + codings).AcceptEncoding().Get().ReadBodyClose()
+		if err != nil {
+			t.Fatalf("%s: %v", codings, err)
+		}
+		if !bytes.Equal(body, content) {
+			t.Errorf("%s: expect %d decoded bytes, got %d", codings, len(content), len(body))
+		}
+	}
+	if !strings.HasPrefix(acceptEncoding, "gzip, deflate, br, zstd") {
+		t.Errorf("expect gzip, deflate, br, zstd, got %s", acceptEncoding)
+	}
+}
+
+func TestDecompressRawDeflate(t *testing.T) {
+	content := []byte(strings.Repeat("ghttpclient", 1000))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "deflate")
+		w.Write(compress(t, content, "raw-deflate"))
+	}))
+	defer server.Close()
+
+	body, err := ghttpclient.NewClient().Url(server.URL).AcceptEncoding().Get().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(body, content) {
+		t.Errorf("expect %d decoded bytes, got %d", len(content), len(body))
+	}
+}
+
+func TestUnknownEncoding(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip, "+r.URL.Query().Get("coding"))
+		w.Write(compress(t, []byte("ghttpclient"), "gzip"))
+	}))
+	defer server.Close()
+
+	_, err := ghttpclient.NewClient().Url(server.URL+"?coding=unknown").Header("Accept-Encoding", "gzip").Get().ReadBodyClose()
+	var unknown *ghttpclient.UnknownEncodingError
+	if !errors.As(err, &unknown) || unknown.Encoding != "unknown" {
+		t.Fatalf("expect an unknown coding error, got %v", err)
+	}
+
+	ghttpclient.RegisterDecompressor("rot13", func(r io.Reader) (io.ReadCloser, error) {
+		return ioutil.NopCloser(r), nil
+	})
+	if !strings.HasSuffix(ghttpclient.AcceptEncoding(), ", rot13") {
+		t.Errorf("expect rot13 to be accepted, got %s", ghttpclient.AcceptEncoding())
+	}
+	body, err := ghttpclient.NewClient().Url(server.URL+"?coding=rot13").Header("Accept-Encoding", "gzip").Get().ReadBodyClose()
+	if err != nil || string(body) != "ghttpclient" {
+		t.Errorf("expect ghttpclient, got %s and %v", body, err)
+	}
+}
+
+func TestAcceptEncodingByDefault(t *testing.T) {
+	content := []byte(strings.Repeat("ghttpclient", 1000))
+	var acceptEncoding string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+		if strings.Contains(acceptEncoding, "zstd") {
+			w.Header().Set("Content-Encoding", "zstd")
+			w.Write(compress(t, content, "zstd"))
+			return
+		}
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	response, err := ghttpclient.NewClient().Url(server.URL).Get().Response()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if !strings.HasPrefix(acceptEncoding, "gzip, deflate, br, zstd") {
+		t.Errorf("expect gzip, deflate, br, zstd, got %s", acceptEncoding)
+	}
+	if !bytes.Equal(body, content) || response.Header.Get("Content-Encoding") != "" {
+		t.Errorf("expect the response decoded transparently, got %d bytes with %s", len(body), response.Header.Get("Content-Encoding"))
+	}
+
+	body, err = ghttpclient.NewTemplate().NoAcceptEncoding(true).R().Url(server.URL).Get().ReadBodyClose()
+	if err != nil || !bytes.Equal(body, content) {
+		t.Errorf("expect %d bytes, got %d and %v", len(content), len(body), err)
+	}
+	if acceptEncoding != "gzip" {
+		t.Errorf("expect the gzip of the transport, got %s", acceptEncoding)
+	}
+}
+
+func TestZstdMaxWindow(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	w, _ := zstd.NewWriter(buffer, zstd.WithWindowSize(16<<20), zstd.WithSingleSegment(false))
+	w.Write(bytes.Repeat([]byte("ghttpclient"), 1<<20))
+	w.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "zstd")
+		w.Write(buffer.Bytes())
+	}))
+	defer server.Close()
+
+	_, err := ghttpclient.NewClient().Url(server.URL).Get().ReadBodyClose()
+	if err == nil {
+		t.Error("expect a zstd window larger than 8 MB to be refused")
+	}
+}
@@ -0,0 +1,395 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DownloadOptions are the options of Download
+type DownloadOptions struct {
+	RequestOptions
+	// Resume continues the partial file left by a previous download of the same url, unless the file has changed
+	Resume bool
+	// Parallel is the number of concurrent range requests,
+	// used when a HEAD request tells the size and that the server accepts ranges
+	// A parallel download is not resumed
+	Parallel int
+	// Checksum is the expected checksum of the file, "sha256:<hex>" or "md5:<hex>"
+	Checksum string
+	// OnProgress receives the number of bytes of the file downloaded, and its size, -1 if unknown
+	// It is called at most once per DefaultProgressInterval, and once more when the file is downloaded
+	OnProgress func(received, total int64)
+}
+
+// ChecksumError is returned by Download when the checksum of the downloaded file does not match
+type ChecksumError struct {
+	Algorithm string
+	Expected  string
+	Actual    string
+}
+
+// Error implements the error interface
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("%s checksum mismatch: expected %s, got %s", e.Algorithm, e.Expected, e.Actual)
+}
+
+// downloadMeta is stored next to the partial file, to check that the file has not changed when resuming
+type downloadMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Size         int64  `json:"size"`
+}
+
+// validator returns the If-Range value of the file, empty if the file can not be validated
+func (m *downloadMeta) validator() string {
+	if m.ETag != "" && !strings.HasPrefix(m.ETag, "W/") {
+		return m.ETag
+	}
+	return m.LastModified
+}
+
+// Download streams the file at url to destPath
+// The file is written to destPath+".part", which is renamed to destPath once downloaded and verified
+func Download(ctx context.Context, url, destPath string, opts *DownloadOptions) error {
+	if opts == nil {
+		opts = &DownloadOptions{}
+	}
+	algorithm, expected, hasher, err := parseChecksum(opts.Checksum)
+	if err != nil {
+		return err
+	}
+	d := &downloader{
+		ctx:      ctx,
+		url:      url,
+		opts:     opts,
+		resume:   opts.Resume,
+		partPath: destPath + ".part",
+		metaPath: destPath + ".part.json",
+	}
+
+	downloaded := false
+	if opts.Parallel > 1 {
+		if downloaded, err = d.parallel(); err != nil {
+			return err
+		}
+	}
+	if !downloaded {
+		if err := d.sequential(); err != nil {
+			return err
+		}
+	}
+
+	if hasher != nil {
+		actual, err := hashFile(d.partPath, hasher)
+		if err != nil {
+			return err
+		}
+		if actual != expected {
+			os.Remove(d.partPath)
+			os.Remove(d.metaPath)
+			return &ChecksumError{Algorithm: algorithm, Expected: expected, Actual: actual}
+		}
+	}
+	if err := os.Rename(d.partPath, destPath); err != nil {
+		return err
+	}
+	os.Remove(d.metaPath)
+	return nil
+}
+
+// downloader downloads a file
+type downloader struct {
+	ctx      context.Context
+	url      string
+	opts     *DownloadOptions
+	resume   bool
+	partPath string
+	metaPath string
+}
+
+// request returns a client requesting the file, without content coding so that ranges are byte offsets of the file
+func (d *downloader) request() *GHttpClient {
+	return d.opts.RequestOptions.newRequest(d.url).Header("Accept-Encoding", "identity")
+}
+
+// progress returns a reporter of the download progress, nil if there is no callback
+func (d *downloader) progress(received, total int64) *progressReporter {
+	if d.opts.OnProgress == nil {
+		return nil
+	}
+	return newProgressReporter(received, total, DefaultProgressInterval, d.opts.OnProgress)
+}
+
+// sequential downloads the file with a single request, resuming the partial file if possible
+func (d *downloader) sequential() error {
+	g := d.request().ExpectStatus(http.StatusOK, http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable)
+	meta := d.loadMeta()
+	var offset int64
+	if meta != nil {
+		if info, err := os.Stat(d.partPath); err == nil && info.Size() > 0 {
+			offset = info.Size()
+			g.Header("Range", "bytes="+strconv.FormatInt(offset, 10)+"-").Header("If-Range", meta.validator())
+		}
+	}
+	response, err := g.GetWithContext(d.ctx).Response()
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	size := response.ContentLength
+	switch response.StatusCode {
+	case http.StatusRequestedRangeNotSatisfiable:
+		if offset == 0 {
+			return statusError(g.request, response, nil)
+		}
+		if offset == meta.Size {
+			return nil
+		}
+		d.resume = false
+		return d.sequential()
+	case http.StatusPartialContent:
+		start, total, err := parseContentRange(response.Header.Get("Content-Range"))
+		if err != nil || start != offset {
+			return fmt.Errorf("unexpected Content-Range %q for offset %d", response.Header.Get("Content-Range"), offset)
+		}
+		if offset > 0 {
+			flag = os.O_WRONLY | os.O_APPEND
+		}
+		size = total
+	default:
+		offset = 0
+	}
+
+	newMeta := &downloadMeta{
+		URL:          d.url,
+		ETag:         response.Header.Get("ETag"),
+		LastModified: response.Header.Get("Last-Modified"),
+		Size:         size,
+	}
+	if meta != nil && offset > 0 && newMeta.ETag == "" && newMeta.LastModified == "" {
+		newMeta.ETag, newMeta.LastModified = meta.ETag, meta.LastModified
+	}
+	if err := d.saveMeta(newMeta); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(d.partPath, flag, 0644)
+	if err != nil {
+		return err
+	}
+	var body io.Reader = response.Body
+	if reporter := d.progress(offset, size); reporter != nil {
+		body = &progressReader{ReadCloser: response.Body, reporter: reporter}
+	}
+	written, err := io.Copy(file, body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if size >= 0 && offset+written != size {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// parallel downloads the file with concurrent range requests,
+// it returns false without error when the server does not tell the size or does not accept ranges
+func (d *downloader) parallel() (bool, error) {
+	response, err := d.request().HeadWithContext(d.ctx).Response()
+	if err != nil {
+		return false, err
+	}
+	response.Body.Close()
+	size := response.ContentLength
+	if response.StatusCode != http.StatusOK || response.Header.Get("Accept-Ranges") != "bytes" || size <= 0 {
+		return false, nil
+	}
+	meta := &downloadMeta{ETag: response.Header.Get("ETag"), LastModified: response.Header.Get("Last-Modified")}
+	validator := meta.validator()
+
+	// a partial file of a parallel download has holes, it must not be resumed
+	os.Remove(d.metaPath)
+	file, err := os.OpenFile(d.partPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return false, err
+	}
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return false, err
+	}
+
+	ctx, cancel := context.WithCancel(d.ctx)
+	defer cancel()
+	var mu sync.Mutex
+	var firstErr error
+	reporter := d.progress(0, size)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+
+	var wg sync.WaitGroup
+	chunk := (size + int64(d.opts.Parallel) - 1) / int64(d.opts.Parallel)
+	for start := int64(0); start < size; start += chunk {
+		end := start + chunk - 1
+		if end >= size {
+			end = size - 1
+		}
+		wg.Add(1)
+		go func(start, end int64) {
+			defer wg.Done()
+			g := d.request().ExpectStatus(http.StatusPartialContent).Header("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+			if validator != "" {
+				g.Header("If-Range", validator)
+			}
+			response, err := g.GetWithContext(ctx).Response()
+			if err != nil {
+				fail(err)
+				return
+			}
+			defer response.Body.Close()
+			var w io.Writer = &offsetWriter{w: file, offset: start}
+			if reporter != nil {
+				w = &lockedProgressWriter{w: w, mu: &mu, reporter: reporter}
+			}
+			written, err := io.Copy(w, io.LimitReader(response.Body, end-start+1))
+			if err == nil && written != end-start+1 {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				fail(err)
+			}
+		}(start, end)
+	}
+	wg.Wait()
+
+	if err := file.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr == nil, firstErr
+}
+
+// loadMeta returns the stored information of the partial file, nil if it can not be resumed
+func (d *downloader) loadMeta() *downloadMeta {
+	if !d.resume {
+		return nil
+	}
+	content, err := os.ReadFile(d.metaPath)
+	if err != nil {
+		return nil
+	}
+	meta := &downloadMeta{}
+	if err := json.Unmarshal(content, meta); err != nil || meta.URL != d.url || meta.validator() == "" {
+		return nil
+	}
+	return meta
+}
+
+// saveMeta stores the information of the partial file
+func (d *downloader) saveMeta(meta *downloadMeta) error {
+	content, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(d.metaPath, content, 0644)
+}
+
+// parseChecksum parses a "sha256:<hex>" or "md5:<hex>" checksum, the hasher is nil for an empty checksum
+func parseChecksum(checksum string) (string, string, hash.Hash, error) {
+	if checksum == "" {
+		return "", "", nil, nil
+	}
+	algorithm, expected, _ := strings.Cut(checksum, ":")
+	algorithm = strings.ToLower(algorithm)
+	switch algorithm {
+	case "sha256":
+		return algorithm, strings.ToLower(expected), sha256.New(), nil
+	case "md5":
+		return algorithm, strings.ToLower(expected), md5.New(), nil
+	}
+	return "", "", nil, fmt.Errorf("unsupported checksum %q, sha256:<hex> or md5:<hex> expected", checksum)
+}
+
+// hashFile returns the hex checksum of a file
+func hashFile(path string, hasher hash.Hash) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// parseContentRange parses a "bytes start-end/total" Content-Range, total is -1 if unknown
+func parseContentRange(contentRange string) (int64, int64, error) {
+	if !strings.HasPrefix(contentRange, "bytes ") {
+		return 0, 0, errors.New("invalid Content-Range")
+	}
+	byteRange, rawTotal, _ := strings.Cut(strings.TrimPrefix(contentRange, "bytes "), "/")
+	rawStart, _, _ := strings.Cut(byteRange, "-")
+	start, err := strconv.ParseInt(rawStart, 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	if rawTotal == "*" {
+		return start, -1, nil
+	}
+	total, err := strconv.ParseInt(rawTotal, 10, 64)
+	return start, total, err
+}
+
+// offsetWriter writes sequentially from an offset of a io.WriterAt
+type offsetWriter struct {
+	w      io.WriterAt
+	offset int64
+}
+
+// Write implements io.Writer
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.w.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
+
+// lockedProgressWriter reports the bytes written to a reporter shared by several writers
+type lockedProgressWriter struct {
+	w        io.Writer
+	mu       *sync.Mutex
+	reporter *progressReporter
+}
+
+// Write implements io.Writer
+func (w *lockedProgressWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.mu.Lock()
+	w.reporter.add(int64(n), false)
+	w.mu.Unlock()
+	return n, err
+}
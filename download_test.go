@@ -0,0 +1,193 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/panwenbin/ghttpclient"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFileServer returns a server serving content with ranges, whose GETs are aborted halfway while abort returns true,
+// and a function returning the Range headers received
+func newFileServer(t *testing.T, content []byte, etag string, abort func() bool) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		if r.Method == http.MethodGet {
+			mu.Lock()
+			ranges = append(ranges, r.Header.Get("Range"))
+			mu.Unlock()
+			if abort != nil && abort() {
+				w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+				w.Write(content[:len(content)/2])
+				w.(http.Flusher).Flush()
+				panic(http.ErrAbortHandler)
+			}
+		}
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), ranges...)
+	}
+}
+
+func sha256Hex(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestDownloadResume(t *testing.T) {
+	content := bytes.Repeat([]byte("ghttpclient"), 10000)
+	server, ranges := newFileServer(t, content, `"v1"`, failFirst(1))
+	dest := filepath.Join(t.TempDir(), "file.bin")
+	opts := &ghttpclient.DownloadOptions{Resume: true, Checksum: "sha256:" + sha256Hex(content)}
+
+	if err := ghttpclient.Download(context.Background(), server.URL, dest, opts); err == nil {
+		t.Fatal("expect the aborted download to fail")
+	}
+	if _, err := os.Stat(dest + ".part"); err != nil {
+		t.Fatalf("expect a partial file, got %v", err)
+	}
+
+	var received, total int64
+	opts.OnProgress = func(r, t int64) { received, total = r, t }
+	if err := ghttpclient.Download(context.Background(), server.URL, dest, opts); err != nil {
+		t.Fatal(err)
+	}
+	downloaded, _ := os.ReadFile(dest)
+	if !bytes.Equal(downloaded, content) {
+		t.Errorf("expect %d bytes, got %d", len(content), len(downloaded))
+	}
+	if r := ranges(); len(r) != 2 || r[1] != "bytes="+strconv.Itoa(len(content)/2)+"-" {
+		t.Errorf("expect the second request to resume from the half, got ranges %q", r)
+	}
+	if received != int64(len(content)) || total != int64(len(content)) {
+		t.Errorf("expect %d of %d bytes, got %d of %d", len(content), len(content), received, total)
+	}
+	if _, err := os.Stat(dest + ".part"); !os.IsNotExist(err) {
+		t.Errorf("expect the partial file to be renamed, got %v", err)
+	}
+}
+
+func TestDownloadChangedFile(t *testing.T) {
+	content := bytes.Repeat([]byte("ghttpclient"), 10000)
+	changed := bytes.Repeat([]byte("GHTTPCLIENT"), 10000)
+	var calls int32
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content[:len(content)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		w.Header().Set("ETag", `"v2"`)
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(changed))
+	}))
+	defer server.Close()
+	dest := filepath.Join(t.TempDir(), "file.bin")
+	opts := &ghttpclient.DownloadOptions{Resume: true}
+	ghttpclient.Download(context.Background(), server.URL, dest, opts)
+
+	if err := ghttpclient.Download(context.Background(), server.URL, dest, opts); err != nil {
+		t.Fatal(err)
+	}
+	downloaded, _ := os.ReadFile(dest)
+	if !bytes.Equal(downloaded, changed) {
+		t.Error("expect the changed file to be downloaded from the start")
+	}
+	if len(ranges) != 2 || ranges[1] == "" {
+		t.Errorf("expect the second request to try to resume, got ranges %q", ranges)
+	}
+}
+
+func TestDownloadPartialContentWithoutRange(t *testing.T) {
+	content := bytes.Repeat([]byte("ghttpclient"), 10000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Range", "bytes 0-"+strconv.Itoa(len(content)-1)+"/"+strconv.Itoa(len(content)))
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(content)
+	}))
+	defer server.Close()
+	dest := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(dest+".part", []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ghttpclient.Download(context.Background(), server.URL, dest, &ghttpclient.DownloadOptions{Resume: true}); err != nil {
+		t.Fatal(err)
+	}
+	downloaded, _ := os.ReadFile(dest)
+	if !bytes.Equal(downloaded, content) {
+		t.Errorf("expect %d bytes, got %d", len(content), len(downloaded))
+	}
+}
+
+func TestDownloadParallel(t *testing.T) {
+	content := bytes.Repeat([]byte("ghttpclient"), 10000)
+	server, ranges := newFileServer(t, content, `"v1"`, nil)
+	dest := filepath.Join(t.TempDir(), "file.bin")
+
+	var mu sync.Mutex
+	var received int64
+	err := ghttpclient.Download(context.Background(), server.URL, dest, &ghttpclient.DownloadOptions{
+		Parallel: 4,
+		Checksum: "sha256:" + sha256Hex(content),
+		OnProgress: func(r, t int64) {
+			mu.Lock()
+			received = r
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	downloaded, _ := os.ReadFile(dest)
+	if !bytes.Equal(downloaded, content) {
+		t.Errorf("expect %d bytes, got %d", len(content), len(downloaded))
+	}
+	if r := ranges(); len(r) != 4 {
+		t.Errorf("expect 4 range requests, got %q", r)
+	}
+	if received != int64(len(content)) {
+		t.Errorf("expect %d bytes, got %d", len(content), received)
+	}
+}
+
+func TestDownloadChecksumMismatch(t *testing.T) {
+	server, _ := newFileServer(t, []byte("ghttpclient"), `"v1"`, nil)
+	dest := filepath.Join(t.TempDir(), "file.bin")
+
+	err := ghttpclient.Download(context.Background(), server.URL, dest, &ghttpclient.DownloadOptions{Checksum: "md5:00"})
+	var checksumErr *ghttpclient.ChecksumError
+	if !errors.As(err, &checksumErr) || checksumErr.Algorithm != "md5" {
+		t.Fatalf("expect a md5 checksum error, got %v", err)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("expect no file, got %v", err)
+	}
+	if _, err := os.Stat(dest + ".part"); !os.IsNotExist(err) {
+		t.Errorf("expect no partial file, got %v", err)
+	}
+}
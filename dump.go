@@ -0,0 +1,248 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync"
+)
+
+// DefaultDumpBodyBytes is the maximum number of body bytes dumped when DumpOptions.MaxBodyBytes is 0
+const DefaultDumpBodyBytes = 64 * 1024
+
+// DumpOptions are the options of Dump
+type DumpOptions struct {
+	// MaxBodyBytes is the maximum number of body bytes dumped, 0 means DefaultDumpBodyBytes
+	MaxBodyBytes int64
+	// SkipBody dumps only the request line, the status line and the headers
+	SkipBody bool
+}
+
+// Dump writes every request sent by the client and its response to w in wire format,
+// redirects and retries included. Secrets are hidden by the redactor of the client.
+// The request bodies are peeked, so they can still be sent, and the response bodies are dumped as they are read,
+// once they are read to the end, closed or read up to the maximum size.
+// Compressed bodies are dumped decoded.
+func (g *GHttpClient) Dump(w io.Writer, opts *DumpOptions) *GHttpClient {
+	if opts == nil {
+		opts = &DumpOptions{}
+	}
+	g.dump = &dumpTransport{mu: &sync.Mutex{}, w: w, opts: *opts}
+	return g
+}
+
+// dumpTransport dumps the requests and responses going through the next RoundTripper
+type dumpTransport struct {
+	// mu is shared by the transports wrapped for the writer, so that concurrent dumps do not interleave
+	mu       *sync.Mutex
+	w        io.Writer
+	opts     DumpOptions
+	redactor *Redactor
+	next     http.RoundTripper
+}
+
+// wrap returns a dumpTransport wrapping the RoundTripper
+func (d *dumpTransport) wrap(next http.RoundTripper, redactor *Redactor) *dumpTransport {
+	return &dumpTransport{mu: d.mu, w: d.w, opts: d.opts, redactor: redactor, next: next}
+}
+
+// RoundTrip implements http.RoundTripper
+func (d *dumpTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	requestDump, request, err := d.dumpRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	response, err := d.next.RoundTrip(request)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fmt.Fprintf(d.w, ">>> GHTTP REQUEST\r\n%s\r\n", requestDump)
+	if err != nil {
+		fmt.Fprintf(d.w, "<<< GHTTP ERROR\r\n%s\r\n\r\n", d.redactor.RedactError(err))
+		return nil, err
+	}
+	fmt.Fprintf(d.w, "<<< GHTTP RESPONSE\r\n%s\r\n", d.dumpResponse(response))
+	return response, nil
+}
+
+// maxBodyBytes returns the maximum number of body bytes dumped
+func (d *dumpTransport) maxBodyBytes() int64 {
+	if d.opts.MaxBodyBytes > 0 {
+		return d.opts.MaxBodyBytes
+	}
+	return DefaultDumpBodyBytes
+}
+
+// dumpRequest dumps the request, it returns the request to send, whose body is restored after peeking
+func (d *dumpTransport) dumpRequest(request *http.Request) ([]byte, *http.Request, error) {
+	redacted := request.Clone(request.Context())
+	redacted.URL = d.redactor.redactURL(request.URL)
+	redacted.Header = d.redactor.RedactHeader(request.Header)
+	redacted.Body = nil
+	if request.Body != nil && request.Body != http.NoBody && request.ContentLength != 0 {
+		// DumpRequestOut writes a Content-Length header only for a request with a body
+		redacted.Body = ioutil.NopCloser(strings.NewReader(""))
+	}
+	head, err := httputil.DumpRequestOut(redacted, false)
+	if err != nil {
+		return nil, request, err
+	}
+	if d.opts.SkipBody || request.Body == nil || request.Body == http.NoBody {
+		return head, request, nil
+	}
+
+	var prefix []byte
+	var truncated bool
+	if request.GetBody != nil {
+		body, err := request.GetBody()
+		if err != nil {
+			return nil, request, err
+		}
+		prefix, truncated, err = peek(body, d.maxBodyBytes())
+		body.Close()
+		if err != nil {
+			return nil, request, err
+		}
+		// the bodies of GetBody may share an offset, such as the bodies of a file, the sent body starts over
+		if body, err = request.GetBody(); err != nil {
+			return nil, request, err
+		}
+		request.Body.Close()
+		restored := *request
+		restored.Body = body
+		request = &restored
+	} else {
+		prefix, truncated, err = peek(request.Body, d.maxBodyBytes())
+		if err != nil {
+			return nil, request, err
+		}
+		restored := *request
+		restored.Body = &multiReadCloser{
+			Reader: io.MultiReader(bytes.NewReader(prefix), request.Body),
+			Closer: request.Body,
+		}
+		request = &restored
+	}
+
+	return append(head, d.formatBody(prefix, truncated, request.Header, request.Header.Get("Content-Type"))...), request, nil
+}
+
+// dumpResponse dumps the head of the response, its body is dumped by a dumpBody as it is read
+func (d *dumpTransport) dumpResponse(response *http.Response) []byte {
+	redacted := *response
+	redacted.Header = d.redactor.RedactHeader(response.Header)
+	head, err := httputil.DumpResponse(&redacted, false)
+	if err != nil {
+		return []byte(err.Error())
+	}
+	if d.opts.SkipBody || response.Body == nil || response.Body == http.NoBody {
+		return head
+	}
+
+	// decodeResponse removes Content-Encoding once the response is returned, the body is decoded with the header received
+	response.Body = &dumpBody{ReadCloser: response.Body, d: d, header: response.Header.Clone()}
+	return head
+}
+
+// dumpBody dumps a response body as it is read, once it is read to the end, closed or read up to the maximum size
+type dumpBody struct {
+	io.ReadCloser
+	d      *dumpTransport
+	header http.Header
+	prefix []byte
+	eof    bool
+	once   sync.Once
+}
+
+// Read implements io.Reader, it keeps one byte more than the maximum size to tell whether the body is truncated
+func (b *dumpBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if keep := b.d.maxBodyBytes() + 1 - int64(len(b.prefix)); keep > 0 {
+		if int64(n) < keep {
+			keep = int64(n)
+		}
+		b.prefix = append(b.prefix, p[:keep]...)
+	}
+	if err == io.EOF {
+		b.eof = true
+	}
+	if err != nil || int64(len(b.prefix)) > b.d.maxBodyBytes() {
+		b.dump()
+	}
+	return n, err
+}
+
+// Close implements io.Closer, a body closed before its end is dumped as truncated
+func (b *dumpBody) Close() error {
+	b.dump()
+	return b.ReadCloser.Close()
+}
+
+// dump writes the body once
+func (b *dumpBody) dump() {
+	b.once.Do(func() {
+		truncated := !b.eof || int64(len(b.prefix)) > b.d.maxBodyBytes()
+		body := b.d.formatBody(b.prefix, truncated, b.header, b.header.Get("Content-Type"))
+		b.d.mu.Lock()
+		defer b.d.mu.Unlock()
+		fmt.Fprintf(b.d.w, "<<< GHTTP RESPONSE BODY\r\n%s\r\n", body)
+	})
+}
+
+// formatBody decodes a compressed body, redacts a complete JSON body and marks a truncated body
+// A truncated JSON body can not be redacted, so it is not shown
+func (d *dumpTransport) formatBody(body []byte, truncated bool, httpHeader http.Header, contentType string) []byte {
+	// body is shared with the restored body, it must not be modified
+	if int64(len(body)) > d.maxBodyBytes() {
+		body = body[:d.maxBodyBytes()]
+	}
+	body = append([]byte(nil), body...)
+	if codings := contentCodings(httpHeader); len(codings) > 0 {
+		reader, decoders, err := decompress(bytes.NewReader(body), httpHeader)
+		if err != nil {
+			return []byte("(" + strings.Join(codings, ", ") + " body can not be decoded)\r\n")
+		}
+		// a truncated compressed body ends with an error, what has been decoded is still dumped
+		decoded, _ := ioutil.ReadAll(io.LimitReader(reader, d.maxBodyBytes()+1))
+		closeAll(decoders)
+		if int64(len(decoded)) > d.maxBodyBytes() {
+			decoded, truncated = decoded[:d.maxBodyBytes()], true
+		}
+		body = decoded
+	}
+	if strings.Contains(contentType, "json") {
+		if truncated {
+			return []byte("(json body truncated, not shown)\r\n")
+		}
+		body = d.redactor.RedactJSON(body)
+	}
+	if truncated {
+		body = append(body, "\r\n(body truncated)"...)
+	}
+	return append(body, "\r\n"...)
+}
+
+// peek reads up to n+1 bytes, and tells whether there are more than n bytes
+func peek(r io.Reader, n int64) ([]byte, bool, error) {
+	prefix, err := ioutil.ReadAll(io.LimitReader(r, n+1))
+	if err != nil {
+		return prefix, false, err
+	}
+	if int64(len(prefix)) > n {
+		return prefix, true, nil
+	}
+	return prefix, false, nil
+}
+
+// multiReadCloser reads from Reader and closes Closer
+type multiReadCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,199 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient_test
+
+import (
+	"bytes"
+	"github.com/panwenbin/ghttpclient"
+	"github.com/panwenbin/ghttpclient/header"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDump(t *testing.T) {
+	server := newEchoServer(t)
+	buffer := &bytes.Buffer{}
+	body, err := ghttpclient.NewClient().Url(server.URL+"/?access_token=secret").
+		Header("Authorization", "Bearer secret").
+		ContentType(header.CONTENT_TYPE_JSON).
+		Body(ioutil.NopCloser(strings.NewReader(`{"password":"secret","msg":"ghttpclient"}`))).
+		Dump(buffer, nil).Post().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != `{"password":"secret","msg":"ghttpclient"}` {
+		t.Errorf("expect the body untouched by the dump, got %s", body)
+	}
+
+	dump := buffer.String()
+	for _, expect := range []string{"POST /?access_token=[REDACTED] HTTP/1.1", "Authorization: [REDACTED]", `"msg":"ghttpclient"`, "HTTP/1.1 200 OK"} {
+		if !strings.Contains(dump, expect) {
+			t.Errorf("expect %s in dump, got %s", expect, dump)
+		}
+	}
+	if strings.Contains(dump, "Bearer secret") {
+		t.Errorf("expect no secret in dump, got %s", dump)
+	}
+}
+
+func TestDumpGzipAndTruncate(t *testing.T) {
+	server := newEchoServer(t)
+	buffer := &bytes.Buffer{}
+	content := strings.Repeat("ghttpclient", 100)
+	body, err := ghttpclient.NewClient().Url(server.URL+"/").
+		Headers(header.GHttpHeader{}.AcceptEncodingGzip()).
+		Body(strings.NewReader(content)).
+		Dump(buffer, &ghttpclient.DumpOptions{MaxBodyBytes: 100}).Post().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != content {
+		t.Errorf("expect the whole body, got %d bytes", len(body))
+	}
+
+	dump := buffer.String()
+	if !strings.Contains(dump, "Content-Encoding: gzip") || !strings.Contains(dump, "(body truncated)") {
+		t.Errorf("expect a gzip response and a truncated request body, got %s", dump)
+	}
+	if !strings.Contains(dump[strings.Index(dump, "<<< GHTTP RESPONSE"):], "ghttpclientghttpclient") {
+		t.Errorf("expect the gzip response body decoded, got %s", dump)
+	}
+}
+
+func TestDumpDefaultAcceptEncoding(t *testing.T) {
+	server := newEchoServer(t)
+	buffer := &bytes.Buffer{}
+	body, err := ghttpclient.NewClient().Url(server.URL+"/").
+		Body(strings.NewReader("ghttpclient")).
+		Dump(buffer, nil).Post().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "ghttpclient" {
+		t.Errorf("expect ghttpclient, got %s", body)
+	}
+
+	dump := buffer.String()
+	if !strings.Contains(dump, "Content-Encoding: gzip") {
+		t.Errorf("expect a gzip response, got %s", dump)
+	}
+	if !strings.Contains(dump, "<<< GHTTP RESPONSE BODY\r\nghttpclient\r\n") {
+		t.Errorf("expect the gzip response body decoded, got %s", dump)
+	}
+}
+
+func TestDumpTruncatedJSON(t *testing.T) {
+	server := newEchoServer(t)
+	buffer := &bytes.Buffer{}
+	content := `{"password":"secret","msg":"` + strings.Repeat("ghttpclient", 100) + `"}`
+	_, err := ghttpclient.NewClient().Url(server.URL+"/").
+		ContentType(header.CONTENT_TYPE_JSON).
+		Body(strings.NewReader(content)).
+		Dump(buffer, &ghttpclient.DumpOptions{MaxBodyBytes: 100}).Post().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dump := buffer.String()
+	if strings.Contains(dump, "secret") {
+		t.Errorf("expect no secret in dump, got %s", dump)
+	}
+	if !strings.Contains(dump, "(json body truncated, not shown)") {
+		t.Errorf("expect the truncated json body not shown, got %s", dump)
+	}
+}
+
+func TestDumpSlowBody(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			w.Write([]byte("ghttpclient"))
+			w.(http.Flusher).Flush()
+			w.Write([]byte("ghttpclient"))
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(2*len("ghttpclient")))
+		w.Write([]byte("ghttpclient"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-time.After(2 * time.Second):
+		}
+		w.Write([]byte("ghttpclient"))
+	}))
+	defer server.Close()
+
+	buffer := &bytes.Buffer{}
+	client := ghttpclient.NewClient().Url(server.URL).Dump(buffer, nil)
+	start := time.Now()
+	stream, err := client.Get().Stream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expect the response without waiting for its body, got %s", elapsed)
+	}
+	close(release)
+	body, _ := ioutil.ReadAll(stream)
+	stream.Close()
+	if string(body) != "ghttpclientghttpclient" {
+		t.Errorf("expect ghttpclientghttpclient, got %s", body)
+	}
+	if !strings.Contains(buffer.String(), "<<< GHTTP RESPONSE BODY\r\nghttpclientghttpclient\r\n") {
+		t.Errorf("expect the body dumped once read, got %s", buffer.String())
+	}
+
+	buffer.Reset()
+	_, err = ghttpclient.NewClient().Url(server.URL+"/chunked").Dump(buffer, nil).Get().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buffer.String(), "Transfer-Encoding: chunked") {
+		t.Errorf("expect a chunked response, got %s", buffer.String())
+	}
+	if !strings.Contains(buffer.String(), "<<< GHTTP RESPONSE BODY\r\nghttpclientghttpclient\r\n") {
+		t.Errorf("expect the chunked body dumped, got %s", buffer.String())
+	}
+}
+
+// overlapWriter records whether two writes overlap
+type overlapWriter struct {
+	writing int32
+	overlap int32
+}
+
+func (w *overlapWriter) Write(p []byte) (int, error) {
+	if atomic.AddInt32(&w.writing, 1) > 1 {
+		atomic.StoreInt32(&w.overlap, 1)
+	}
+	time.Sleep(time.Millisecond)
+	atomic.AddInt32(&w.writing, -1)
+	return len(p), nil
+}
+
+func TestDumpConcurrentTemplate(t *testing.T) {
+	server := newEchoServer(t)
+	writer := &overlapWriter{}
+	template := ghttpclient.NewTemplate().BaseUrl(server.URL).Dump(writer, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			template.R().Url("/ghttpclient").Get().ReadBodyClose()
+		}()
+	}
+	wg.Wait()
+	if atomic.LoadInt32(&writer.overlap) != 0 {
+		t.Error("expect the dumps of a template not to interleave")
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// ErrContentTypeMismatch is returned when the Content-Type of a response is not the expected one
+var ErrContentTypeMismatch = errors.New("content type mismatch")
+
+// StatusErrorBodySize is the maximum number of body bytes kept in a StatusError
+var StatusErrorBodySize = 512
+
+// StatusError is returned when a response has an unexpected status code
+// see ErrorOnStatus and ExpectStatus
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+	Header     http.Header
+	// Body is the beginning of the response body, at most StatusErrorBodySize bytes
+	Body []byte
+}
+
+// Error implements the error interface
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s: unexpected status %s", e.Method, e.URL, e.Status)
+}
+
+// ErrorOnStatus makes a response with a 4xx or 5xx status code an error of type *StatusError
+func (g *GHttpClient) ErrorOnStatus() *GHttpClient {
+	g.errorOnStatus = true
+	return g
+}
+
+// ExpectStatus makes a response with a status code out of codes an error of type *StatusError
+func (g *GHttpClient) ExpectStatus(codes ...int) *GHttpClient {
+	g.expectStatus = append(g.expectStatus, codes...)
+	return g
+}
+
+// unexpectedStatus checks whether the status code is rejected by ErrorOnStatus or ExpectStatus
+func (g *GHttpClient) unexpectedStatus(statusCode int) bool {
+	if len(g.expectStatus) > 0 {
+		for _, code := range g.expectStatus {
+			if statusCode == code {
+				return false
+			}
+		}
+		return true
+	}
+	return g.errorOnStatus && statusCode >= http.StatusBadRequest
+}
+
+// newStatusError builds a StatusError from a response to the request sent, then close the Body
+func newStatusError(request *http.Request, response *http.Response) *StatusError {
+	defer response.Body.Close()
+
+	var reader io.Reader = response.Body
+	if body, err := decodeBody(response, 0); err == nil {
+		reader = body
+	}
+	snippet, _ := ioutil.ReadAll(io.LimitReader(reader, int64(StatusErrorBodySize)))
+	return statusError(request, response, snippet)
+}
+
+// statusError builds a StatusError from a response whose body has been read
+// The request of the response is preferred to the request sent, which a custom RoundTripper may not set
+func statusError(request *http.Request, response *http.Response, body []byte) *StatusError {
+	if len(body) > StatusErrorBodySize {
+		body = body[:StatusErrorBodySize]
+	}
+	if response.Request != nil {
+		request = response.Request
+	}
+	statusErr := &StatusError{
+		StatusCode: response.StatusCode,
+		Status:     response.Status,
+		Header:     response.Header,
+		Body:       body,
+	}
+	if request != nil {
+		statusErr.Method = request.Method
+		statusErr.URL = request.URL.String()
+	}
+	return statusErr
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient_test
+
+import (
+	"errors"
+	"github.com/panwenbin/ghttpclient"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestErrorOnStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("ghttpclient"))
+	}))
+	defer server.Close()
+
+	_, err := ghttpclient.NewClient().Url(server.URL).Get().ReadBodyClose()
+	if err != nil {
+		t.Fatalf("expect no error without ErrorOnStatus, got %s", err)
+	}
+
+	_, err = ghttpclient.NewClient().Url(server.URL).ErrorOnStatus().Get().ReadBodyClose()
+	var statusError *ghttpclient.StatusError
+	if !errors.As(err, &statusError) {
+		t.Fatalf("expect a StatusError, got %v", err)
+	}
+	if statusError.StatusCode != http.StatusInternalServerError || statusError.Method != "GET" {
+		t.Errorf("expect GET 500, got %s %d", statusError.Method, statusError.StatusCode)
+	}
+	if string(statusError.Body) != "ghttpclient" {
+		t.Errorf("expect ghttpclient, got %s", statusError.Body)
+	}
+
+	_, err = ghttpclient.NewClient().Url(server.URL).ExpectStatus(http.StatusInternalServerError).Get().ReadBodyClose()
+	if err != nil {
+		t.Errorf("expect no error with ExpectStatus(500), got %s", err)
+	}
+}
+
+func TestReadJsonCloseContentTypeMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("ghttpclient"))
+	}))
+	defer server.Close()
+
+	var v interface{}
+	err := ghttpclient.NewClient().Url(server.URL).Get().ReadJsonClose(&v)
+	if !errors.Is(err, ghttpclient.ErrContentTypeMismatch) {
+		t.Errorf("expect ErrContentTypeMismatch, got %v", err)
+	}
+}
+
+// stubRoundTripper answers the requests without setting the Request of the responses
+type stubRoundTripper func(request *http.Request) (*http.Response, error)
+
+func (f stubRoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
+
+func TestErrorOnStatusWithoutResponseRequest(t *testing.T) {
+	stub := stubRoundTripper(func(request *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusNotFound,
+			Status:     "404 Not Found",
+			Header:     make(http.Header),
+			Body:       ioutil.NopCloser(strings.NewReader("ghttpclient")),
+		}, nil
+	})
+
+	_, err := ghttpclient.NewClient().Url("http://www.panwenbin.com/missing").RoundTripper(stub).ErrorOnStatus().Get().Response()
+	var statusError *ghttpclient.StatusError
+	if !errors.As(err, &statusError) {
+		t.Fatalf("expect a StatusError, got %v", err)
+	}
+	if statusError.Method != "GET" || statusError.URL != "http://www.panwenbin.com/missing" {
+		t.Errorf("expect GET http://www.panwenbin.com/missing, got %s %s", statusError.Method, statusError.URL)
+	}
+}
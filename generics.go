@@ -0,0 +1,89 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/panwenbin/ghttpclient/header"
+	"net/http"
+)
+
+// Result is a response decoded as a T
+type Result[T any] struct {
+	Value      T
+	StatusCode int
+	Header     http.Header
+	// Body is the raw body when the response can not be decoded or has a non 2xx status code, nil otherwise
+	// The body of a status code rejected by ErrorOnStatus or ExpectStatus is already read by the client,
+	// Body is then only its first StatusErrorBodySize bytes, as StatusError.Body
+	Body []byte
+}
+
+// RequestOptions are the options of the typed helpers such as GetJSON
+type RequestOptions struct {
+	// Template makes the request, a new client is used if nil
+	Template *ClientTemplate
+	Header   header.GHttpHeader
+}
+
+// newRequest returns the client of the request to url with the options
+func (opts *RequestOptions) newRequest(url string) *GHttpClient {
+	if opts == nil {
+		return NewClient().Url(url)
+	}
+	g := NewClient()
+	if opts.Template != nil {
+		g = opts.Template.R()
+	}
+	return g.Url(url).Headers(opts.Header)
+}
+
+// GetJSON sends a Request with GET method, then decodes the json response as a T
+// A response with a non 2xx status code is an error of type *StatusError
+func GetJSON[T any](ctx context.Context, url string, opts *RequestOptions) (*Result[T], error) {
+	return DecodeResult[T](opts.newRequest(url).GetWithContext(ctx))
+}
+
+// Decode decodes the json response of the client as a T, then close the Body
+func Decode[T any](g *GHttpClient) (T, error) {
+	var v T
+	err := g.ReadJsonClose(&v)
+	return v, err
+}
+
+// DecodeResult decodes the json response of the client as a T, then close the Body
+// A response with a non 2xx status code is an error of type *StatusError, the raw body is kept in the result,
+// truncated for a status code rejected by ErrorOnStatus or ExpectStatus
+func DecodeResult[T any](g *GHttpClient) (*Result[T], error) {
+	result := &Result[T]{}
+	var statusErr *StatusError
+	if errors.As(g.err, &statusErr) {
+		result.StatusCode, result.Header, result.Body = statusErr.StatusCode, statusErr.Header, statusErr.Body
+		return result, g.err
+	}
+	if g.err != nil {
+		return result, g.err
+	}
+
+	result.StatusCode, result.Header = g.response.StatusCode, g.response.Header
+	body, err := g.ReadBodyClose()
+	if err != nil {
+		return result, err
+	}
+	if g.response.StatusCode < http.StatusOK || g.response.StatusCode >= http.StatusMultipleChoices {
+		result.Body = body
+		return result, statusError(g.request, g.response, body)
+	}
+	if err := expectJson(g.response); err != nil {
+		result.Body = body
+		return result, err
+	}
+	if err := json.Unmarshal(body, &result.Value); err != nil {
+		result.Body = body
+		return result, err
+	}
+	return result, nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient_test
+
+import (
+	"context"
+	"errors"
+	"github.com/panwenbin/ghttpclient"
+	"github.com/panwenbin/ghttpclient/header"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type user struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func newUserServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users/1":
+			w.Header().Set("Content-Type", header.CONTENT_TYPE_JSON)
+			w.Header().Set("X-Request-Id", r.Header.Get("X-Request-Id"))
+			w.Write([]byte(`{"id":1,"name":"ghttpclient"}`))
+		case "/text":
+			w.Write([]byte("ghttpclient"))
+		default:
+			w.Header().Set("Content-Type", header.CONTENT_TYPE_JSON)
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"not found"}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGetJSON(t *testing.T) {
+	server := newUserServer(t)
+	opts := &ghttpclient.RequestOptions{
+		Template: ghttpclient.NewTemplate().BaseUrl(server.URL),
+		Header:   header.GHttpHeader{"X-Request-Id": "42"},
+	}
+
+	result, err := ghttpclient.GetJSON[user](context.Background(), "/users/1", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Value.ID != 1 || result.Value.Name != "ghttpclient" {
+		t.Errorf("expect user 1 ghttpclient, got %+v", result.Value)
+	}
+	if result.StatusCode != http.StatusOK || result.Header.Get("X-Request-Id") != "42" || result.Body != nil {
+		t.Errorf("expect 200 with the request id and no raw body, got %+v", result)
+	}
+
+	result, err = ghttpclient.GetJSON[user](context.Background(), server.URL+"/users/2", nil)
+	var statusErr *ghttpclient.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("expect a 404 status error, got %v", err)
+	}
+	if result.StatusCode != http.StatusNotFound || string(result.Body) != `{"error":"not found"}` {
+		t.Errorf("expect 404 with the raw body, got %d %s", result.StatusCode, result.Body)
+	}
+
+	result, err = ghttpclient.GetJSON[user](context.Background(), server.URL+"/text", nil)
+	if !errors.Is(err, ghttpclient.ErrContentTypeMismatch) || string(result.Body) != "ghttpclient" {
+		t.Errorf("expect a content type mismatch with the raw body, got %v %s", err, result.Body)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	server := newUserServer(t)
+
+	u, err := ghttpclient.Decode[user](ghttpclient.NewClient().Url(server.URL + "/users/1").Get())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Name != "ghttpclient" {
+		t.Errorf("expect ghttpclient, got %s", u.Name)
+	}
+
+	result, err := ghttpclient.DecodeResult[map[string]string](ghttpclient.NewClient().Url(server.URL + "/users/2").
+		ErrorOnStatus().Get())
+	if err == nil || result.StatusCode != http.StatusNotFound || string(result.Body) != `{"error":"not found"}` {
+		t.Errorf("expect 404 with the raw body, got %v %d %s", err, result.StatusCode, result.Body)
+	}
+}
@@ -1,8 +1,10 @@
 module github.com/panwenbin/ghttpclient
 
-go 1.12
+go 1.18
 
 require (
+	github.com/andybalholm/brotli v1.1.0
+	github.com/klauspost/compress v1.17.0
 	golang.org/x/net v0.0.0-20190628185345-da137c7871d7
 	golang.org/x/text v0.3.0
 )
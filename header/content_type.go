@@ -3,4 +3,5 @@ package header
 const (
 	CONTENT_TYPE_JSON            = "application/json"
 	CONTENT_TYPE_FORM_URLENCODED = "application/x-www-form-urlencoded"
+	CONTENT_TYPE_XML             = "application/xml"
 )
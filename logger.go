@@ -0,0 +1,308 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	green  = string([]byte{27, 91, 57, 55, 59, 52, 50, 109})
+	white  = string([]byte{27, 91, 57, 48, 59, 52, 55, 109})
+	yellow = string([]byte{27, 91, 57, 48, 59, 52, 51, 109})
+	red    = string([]byte{27, 91, 57, 55, 59, 52, 49, 109})
+	reset  = string([]byte{27, 91, 48, 109})
+)
+
+// EventKind is the kind of an Event
+type EventKind string
+
+const (
+	// EventRequest is logged when a request starts
+	EventRequest EventKind = "request"
+	// EventResponse is logged when the response of a request is received
+	EventResponse EventKind = "response"
+	// EventBodyRead is logged when the body of a response is read
+	EventBodyRead EventKind = "body_read"
+	// EventRetry is logged when an attempt of a request is going to be retried
+	EventRetry EventKind = "retry"
+	// EventError is logged when a request fails
+	EventError EventKind = "error"
+)
+
+// Event is a structured log event of a request
+type Event struct {
+	Kind   EventKind
+	Time   time.Time
+	Method string
+	URL    string
+	// Status is the status code of the response, 0 if there is no response
+	Status int
+	// Duration is the time elapsed since the request started
+	Duration time.Duration
+	// Bytes is the number of body bytes received, for EventBodyRead
+	Bytes int64
+	// Attempt is the number of the attempt, starting from 1
+	Attempt int
+	// Wait is the wait before the next attempt, for EventRetry
+	Wait time.Duration
+	// Header is the request header for EventRequest, and the response header for EventResponse
+	Header http.Header
+	// Timings are the connection phase timings of the last attempt for EventResponse, EventBodyRead and EventError,
+	// nil if the client does not Trace
+	Timings *Timings
+	Err     error
+}
+
+// Logger receives the events of requests
+type Logger interface {
+	Log(event Event)
+}
+
+// LoggerFunc is an adapter to use a function as a Logger
+type LoggerFunc func(event Event)
+
+// Log calls f(event)
+func (f LoggerFunc) Log(event Event) {
+	f(event)
+}
+
+// DefaultLogger is the logger of the clients in debug mode without a Logger
+var DefaultLogger Logger = NewTextLogger(os.Stdout)
+
+// Logger sets the logger of the client
+// A client with a logger logs all its events, a client without a logger logs to DefaultLogger in debug mode
+func (g *GHttpClient) Logger(logger Logger) *GHttpClient {
+	g.logger = logger
+	return g
+}
+
+// eventLogger returns the logger which receives the events of the client, nil if events are not logged
+func (g *GHttpClient) eventLogger() Logger {
+	if g.logger != nil {
+		return g.logger
+	}
+	if g.debug {
+		return DefaultLogger
+	}
+	return nil
+}
+
+// logEvent completes the event with the request attributes, then logs it
+func (g *GHttpClient) logEvent(event Event) {
+	logger := g.eventLogger()
+	if logger == nil {
+		return
+	}
+	redactor := g.getRedactor()
+	event.Time = time.Now()
+	if g.request != nil {
+		event.Method = g.request.Method
+		event.URL = redactor.redactURL(g.request.URL).String()
+	} else {
+		event.URL = redactor.RedactURL(g.url)
+	}
+	if !g.startTime.IsZero() {
+		event.Duration = event.Time.Sub(g.startTime)
+	}
+	if event.Status == 0 && g.response != nil && event.Kind != EventRequest {
+		event.Status = g.response.StatusCode
+	}
+	if event.Kind == EventRequest && g.request != nil {
+		event.Header = redactor.RedactHeader(g.request.Header)
+	} else if event.Kind == EventResponse && g.response != nil {
+		event.Header = redactor.RedactHeader(g.response.Header)
+	}
+	if g.tracer != nil && event.Kind != EventRequest && event.Kind != EventRetry {
+		event.Timings = g.tracer.timings()
+	}
+	if event.Err != nil {
+		event.Err = redactor.RedactError(event.Err)
+	}
+	logger.Log(event)
+}
+
+// textLogger writes events as [GHTTP] lines
+type textLogger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	color bool
+}
+
+// NewTextLogger returns a Logger writing an event per line to w,
+// status codes are colored when w is a terminal and NO_COLOR is not set
+func NewTextLogger(w io.Writer) Logger {
+	return &textLogger{w: w, color: isTerminal(w)}
+}
+
+// Log implements Logger
+func (l *textLogger) Log(event Event) {
+	var flag, content string
+	switch event.Kind {
+	case EventRequest:
+		flag = "S"
+	case EventResponse:
+		flag = "R"
+	case EventBodyRead:
+		flag = "E"
+	case EventRetry:
+		flag = "T"
+	case EventError:
+		flag = "X"
+	}
+	if event.Kind != EventRequest {
+		status := fmt.Sprintf("[%d]", event.Status)
+		if l.color {
+			status = statusCodeColor(event.Status) + status + reset
+		}
+		content = fmt.Sprintf(" %s %3.3fs", status, event.Duration.Seconds())
+	}
+	if event.Err != nil {
+		content += " " + event.Err.Error()
+	}
+
+	str := fmt.Sprintf("[GHTTP] %s [%3s] [%s]%s %s\r\n",
+		event.Time.Format("2006-01-02 15:04:05.000"),
+		event.Method,
+		flag,
+		content,
+		event.URL)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.w, str)
+}
+
+// statusCodeColor returns a color for displaying in terminal.
+func statusCodeColor(code int) string {
+	switch {
+	case code < http.StatusContinue:
+		return red
+	case code >= http.StatusContinue && code < http.StatusMultipleChoices:
+		return green
+	case code >= http.StatusMultipleChoices && code < http.StatusBadRequest:
+		return white
+	case code >= http.StatusBadRequest && code < http.StatusInternalServerError:
+		return yellow
+	default:
+		return red
+	}
+}
+
+// isTerminal checks whether w is a terminal which accepts colors
+func isTerminal(w io.Writer) bool {
+	if _, noColor := os.LookupEnv("NO_COLOR"); noColor {
+		return false
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// jsonLogger writes events as JSON lines
+type jsonLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// jsonEvent is the JSON form of an Event
+type jsonEvent struct {
+	Time       string       `json:"time"`
+	Event      string       `json:"event"`
+	Method     string       `json:"method,omitempty"`
+	URL        string       `json:"url"`
+	Status     int          `json:"status,omitempty"`
+	DurationMs float64      `json:"duration_ms"`
+	Bytes      int64        `json:"bytes,omitempty"`
+	Attempt    int          `json:"attempt,omitempty"`
+	WaitMs     float64      `json:"wait_ms,omitempty"`
+	Header     http.Header  `json:"header,omitempty"`
+	Timings    *jsonTimings `json:"timings,omitempty"`
+	Error      string       `json:"error,omitempty"`
+}
+
+// jsonTimings is the JSON form of Timings
+type jsonTimings struct {
+	DNSLookupMs       float64 `json:"dns_lookup_ms"`
+	TCPConnectMs      float64 `json:"tcp_connect_ms"`
+	TLSHandshakeMs    float64 `json:"tls_handshake_ms"`
+	TimeToFirstByteMs float64 `json:"ttfb_ms"`
+	BodyTransferMs    float64 `json:"body_transfer_ms"`
+	TotalMs           float64 `json:"total_ms"`
+	ConnReused        bool    `json:"conn_reused"`
+	RemoteAddr        string  `json:"remote_addr,omitempty"`
+}
+
+// milliseconds returns the duration in milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// NewJSONLogger returns a Logger writing an event per line to w as a JSON object
+func NewJSONLogger(w io.Writer) Logger {
+	return &jsonLogger{w: w}
+}
+
+// Log implements Logger
+func (l *jsonLogger) Log(event Event) {
+	e := jsonEvent{
+		Time:       event.Time.Format(time.RFC3339Nano),
+		Event:      string(event.Kind),
+		Method:     event.Method,
+		URL:        event.URL,
+		Status:     event.Status,
+		DurationMs: milliseconds(event.Duration),
+		Bytes:      event.Bytes,
+		Attempt:    event.Attempt,
+		WaitMs:     milliseconds(event.Wait),
+		Header:     event.Header,
+	}
+	if t := event.Timings; t != nil {
+		e.Timings = &jsonTimings{
+			DNSLookupMs:       milliseconds(t.DNSLookup),
+			TCPConnectMs:      milliseconds(t.TCPConnect),
+			TLSHandshakeMs:    milliseconds(t.TLSHandshake),
+			TimeToFirstByteMs: milliseconds(t.TimeToFirstByte),
+			BodyTransferMs:    milliseconds(t.BodyTransfer),
+			TotalMs:           milliseconds(t.Total),
+			ConnReused:        t.ConnReused,
+			RemoteAddr:        t.RemoteAddr,
+		}
+	}
+	if event.Err != nil {
+		e.Error = event.Err.Error()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(line)
+}
+
+// countingBody counts the bytes read from a response body
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+// Read implements io.Reader
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,76 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+
+package ghttpclient
+
+import (
+	"context"
+	"log/slog"
+)
+
+// slogLogger sends events to a slog.Logger
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger returns a Logger sending events to a slog.Logger,
+// errors at error level, retries at warn level, responses at info level and others at debug level
+func NewSlogLogger(logger *slog.Logger) Logger {
+	return &slogLogger{logger: logger}
+}
+
+// Log implements Logger
+func (l *slogLogger) Log(event Event) {
+	level := slog.LevelDebug
+	switch event.Kind {
+	case EventError:
+		level = slog.LevelError
+	case EventRetry:
+		level = slog.LevelWarn
+	case EventResponse:
+		level = slog.LevelInfo
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", event.Method),
+		slog.String("url", event.URL),
+	}
+	if event.Status != 0 {
+		attrs = append(attrs, slog.Int("status", event.Status))
+	}
+	attrs = append(attrs, slog.Duration("duration", event.Duration))
+	if event.Kind == EventBodyRead {
+		attrs = append(attrs, slog.Int64("bytes", event.Bytes))
+	}
+	if event.Attempt != 0 {
+		attrs = append(attrs, slog.Int("attempt", event.Attempt))
+	}
+	if event.Kind == EventRetry {
+		attrs = append(attrs, slog.Duration("wait", event.Wait))
+	}
+	if len(event.Header) > 0 {
+		headerAttrs := make([]any, 0, len(event.Header))
+		for key, values := range event.Header {
+			headerAttrs = append(headerAttrs, slog.Any(key, values))
+		}
+		attrs = append(attrs, slog.Group("header", headerAttrs...))
+	}
+	if t := event.Timings; t != nil {
+		attrs = append(attrs, slog.Group("timings",
+			slog.Duration("dns_lookup", t.DNSLookup),
+			slog.Duration("tcp_connect", t.TCPConnect),
+			slog.Duration("tls_handshake", t.TLSHandshake),
+			slog.Duration("ttfb", t.TimeToFirstByte),
+			slog.Duration("body_transfer", t.BodyTransfer),
+			slog.Duration("total", t.Total),
+			slog.Bool("conn_reused", t.ConnReused),
+			slog.String("remote_addr", t.RemoteAddr),
+		))
+	}
+	if event.Err != nil {
+		attrs = append(attrs, slog.String("error", event.Err.Error()))
+	}
+	l.logger.LogAttrs(context.Background(), level, "ghttpclient "+string(event.Kind), attrs...)
+}
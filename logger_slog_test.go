@@ -0,0 +1,29 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+
+package ghttpclient_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/panwenbin/ghttpclient"
+	"log/slog"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	server := newEchoServer(t)
+	buffer := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(buffer, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	ghttpclient.NewClient().Url(server.URL + "/ghttpclient").Logger(ghttpclient.NewSlogLogger(logger)).Get().ReadBodyClose()
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buffer.Bytes(), &record); err != nil {
+		t.Fatalf("expect a single info record, got %s", buffer.String())
+	}
+	if record["msg"] != "ghttpclient response" || record["status"] != float64(200) {
+		t.Errorf("unexpected record %s", buffer.String())
+	}
+}
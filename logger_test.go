@@ -0,0 +1,87 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/panwenbin/ghttpclient"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLogger(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("ghttpclient"))
+	}))
+	defer server.Close()
+
+	var events []ghttpclient.Event
+	policy := ghttpclient.NewRetryPolicy()
+	policy.MinBackoff = time.Millisecond
+	_, err := ghttpclient.NewClient().Url(server.URL).Retry(policy).
+		Logger(ghttpclient.LoggerFunc(func(event ghttpclient.Event) {
+			events = append(events, event)
+		})).Get().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var kinds []string
+	for _, event := range events {
+		kinds = append(kinds, string(event.Kind))
+	}
+	if strings.Join(kinds, ",") != "request,retry,response,body_read" {
+		t.Fatalf("expect request,retry,response,body_read, got %s", strings.Join(kinds, ","))
+	}
+	if events[1].Status != http.StatusBadGateway || events[1].Attempt != 1 {
+		t.Errorf("expect a retry of attempt 1 after 502, got attempt %d after %d", events[1].Attempt, events[1].Status)
+	}
+	if events[2].Status != http.StatusOK || events[2].Attempt != 2 || events[2].Method != "GET" {
+		t.Errorf("expect a GET response 200 at attempt 2, got %s %d at attempt %d", events[2].Method, events[2].Status, events[2].Attempt)
+	}
+	if events[3].Bytes != int64(len("ghttpclient")) {
+		t.Errorf("expect %d bytes, got %d", len("ghttpclient"), events[3].Bytes)
+	}
+}
+
+func TestJSONLogger(t *testing.T) {
+	server := newEchoServer(t)
+	buffer := &bytes.Buffer{}
+	ghttpclient.NewClient().Url(server.URL + "/ghttpclient").Logger(ghttpclient.NewJSONLogger(buffer)).Get().ReadBodyClose()
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expect 3 lines, got %s", buffer.String())
+	}
+	var event map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event["event"] != "response" || event["status"] != float64(200) || event["url"] != server.URL+"/ghttpclient" {
+		t.Errorf("unexpected event %s", lines[1])
+	}
+}
+
+func TestTextLogger(t *testing.T) {
+	server := newEchoServer(t)
+	buffer := &bytes.Buffer{}
+	ghttpclient.NewClient().Url(server.URL + "/ghttpclient").Logger(ghttpclient.NewTextLogger(buffer)).Get().ReadBodyClose()
+
+	if strings.Contains(buffer.String(), "\x1b[") {
+		t.Errorf("expect no color out of a terminal, got %q", buffer.String())
+	}
+	if !strings.Contains(buffer.String(), "[GET] [R] [200]") {
+		t.Errorf("expect a response line, got %s", buffer.String())
+	}
+}
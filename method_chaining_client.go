@@ -7,28 +7,23 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
-	"fmt"
 	"github.com/panwenbin/ghttpclient/header"
+	"github.com/panwenbin/ghttpclient/metrics"
 	"io"
-	"log"
 	"net"
 	"net/http"
 	"net/url"
-	"os"
+	"strings"
 	"time"
 )
 
-var (
-	green  = string([]byte{27, 91, 57, 55, 59, 52, 50, 109})
-	white  = string([]byte{27, 91, 57, 48, 59, 52, 55, 109})
-	yellow = string([]byte{27, 91, 57, 48, 59, 52, 51, 109})
-	red    = string([]byte{27, 91, 57, 55, 59, 52, 49, 109})
-	reset  = string([]byte{27, 91, 48, 109})
-)
-
 // Transport is the default transport for ghttpclient
 var Transport *http.Transport
 
+// DefaultRoundTripper replaces Transport for all clients when it is not nil, mainly for testing
+// The requests of the clients with TLS options fail while it is set
+var DefaultRoundTripper http.RoundTripper
+
 // ResetTransport resets the Transport
 func ResetTransport() {
 	Transport = &http.Transport{
@@ -45,15 +40,18 @@ func ResetTransport() {
 		TLSHandshakeTimeout:   10 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
 	}
+	resetTLSTransports()
 }
 
 func init() {
 	ResetTransport()
 }
 
-// SslSkipVerify sets whether or not skipping ssl verify
+// SslSkipVerify skips ssl verify for all clients
+// Deprecated: it affects every client of the process, use InsecureSkipVerify of a client instead
 func SslSkipVerify() {
 	Transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	resetTLSTransports()
 }
 
 // GHttpClient is a Method chaining HTTP Client which is based on net/http.Client
@@ -62,6 +60,7 @@ type GHttpClient struct {
 	request       *http.Request
 	client        *http.Client
 	url           string
+	baseUrl       string
 	sslSkipVerify bool
 	proxy         func(req *http.Request) (*url.URL, error)
 	noRedirect    bool
@@ -73,15 +72,38 @@ type GHttpClient struct {
 	err           error
 	debug         bool
 	startTime     time.Time
-	logger        *log.Logger
+	logger        Logger
+	retryPolicy   *RetryPolicy
+	middlewares   []Middleware
+	errorOnStatus bool
+	expectStatus  []int
+	roundTripper  http.RoundTripper
+	tls           *tlsOptions
+	redactor      *Redactor
+	dump          *dumpTransport
+	tracer        *tracer
+	collector     metrics.Collector
+	route         metrics.RouteFunc
+	query         url.Values
+	multipart     *Multipart
+	onUpload      func(sent, total int64)
+	onDownload    func(received, total int64)
+	progressEvery *time.Duration
+	maxBodySize   int64
+	compression   *compression
+	compressMin   *int64
+	bodyCloser    io.Closer
+	noAcceptEnc   bool
+	autoDecode    bool
+	optionErr     error
 }
 
 // NewClient Returns a new GHttpClient
 func NewClient() *GHttpClient {
 	return &GHttpClient{
-		header: make(header.GHttpHeader),
-		logger: log.New(os.Stdout, "ghttpclient", log.Ldate|log.Ltime|log.Lmicroseconds),
-		debug:  Debug,
+		header:      make(header.GHttpHeader),
+		debug:       Debug,
+		retryPolicy: DefaultRetryPolicy,
 	}
 }
 
@@ -97,41 +119,16 @@ func (g *GHttpClient) Debug(debug bool) *GHttpClient {
 	return g
 }
 
+// LogDebug logs an event of the request by flag, S for the start, R for the response and E for the end of body reading
+// Deprecated: the events are logged by the client, see Logger
 func (g *GHttpClient) LogDebug(flag string) {
-	now := time.Now()
-	var content string
-	if flag == "S" {
-		content = ""
-	} else {
-		statusCode := 0
-		if g.response != nil {
-			statusCode = g.response.StatusCode
-		}
-		content = fmt.Sprintf(" %s[%d]%s %3.3fs", statusCodeColor(statusCode), statusCode, reset, now.Sub(g.startTime).Seconds())
-	}
-
-	str := fmt.Sprintf("[GHTTP] %s [%3s] [%s]%s %s\r\n",
-		now.Format("2006-01-02 15:04:05.000"),
-		g.request.Method,
-		flag,
-		content,
-		g.request.URL)
-	g.logger.Writer().Write([]byte(str))
-}
-
-// statusCodeColor returns a color for displaying in terminal.
-func statusCodeColor(code int) string {
-	switch {
-	case code < http.StatusContinue:
-		return red
-	case code >= http.StatusContinue && code < http.StatusMultipleChoices:
-		return green
-	case code >= http.StatusMultipleChoices && code < http.StatusBadRequest:
-		return white
-	case code >= http.StatusBadRequest && code < http.StatusInternalServerError:
-		return yellow
-	default:
-		return red
+	switch flag {
+	case "S":
+		g.logEvent(Event{Kind: EventRequest})
+	case "R":
+		g.logEvent(Event{Kind: EventResponse})
+	case "E":
+		g.logEvent(Event{Kind: EventBodyRead})
 	}
 }
 
@@ -141,6 +138,12 @@ func (g *GHttpClient) Url(url string) *GHttpClient {
 	return g
 }
 
+// BaseUrl sets the url which a relative url set by Url is joined to
+func (g *GHttpClient) BaseUrl(baseUrl string) *GHttpClient {
+	g.baseUrl = baseUrl
+	return g
+}
+
 // Header sets a header
 func (g *GHttpClient) Header(headerKey, headerValue string) *GHttpClient {
 	g.header.Set(headerKey, headerValue)
@@ -170,6 +173,7 @@ func (g *GHttpClient) UserAgent(userAgent string) *GHttpClient {
 // Body sets the body of the request
 func (g *GHttpClient) Body(body io.Reader) *GHttpClient {
 	g.body = body
+	g.multipart = nil
 	return g
 }
 
@@ -179,13 +183,10 @@ func (g *GHttpClient) CookieJar(cookieJar http.CookieJar) *GHttpClient {
 	return g
 }
 
-// SslSkipVerify sets whether or not skipping ssl verify
-// Deprecated: use package SslSkipVerify instead
+// SslSkipVerify sets whether or not skipping ssl verify for the client
+// Deprecated: use InsecureSkipVerify instead
 func (g *GHttpClient) SslSkipVerify(skip bool) *GHttpClient {
-	if skip {
-		SslSkipVerify()
-	}
-	return g
+	return g.InsecureSkipVerify(skip)
 }
 
 // Proxy sets a proxyFunc
@@ -194,6 +195,13 @@ func (g *GHttpClient) Proxy(proxyFunc func(req *http.Request) (*url.URL, error))
 	return g
 }
 
+// RoundTripper sets the http.RoundTripper which sends the requests instead of Transport
+// Proxy is ignored when a RoundTripper is set, and TLS options such as PinPublicKeys make the requests fail
+func (g *GHttpClient) RoundTripper(roundTripper http.RoundTripper) *GHttpClient {
+	g.roundTripper = roundTripper
+	return g
+}
+
 // NoRedirect sets whether or not to stop following redirects
 func (g *GHttpClient) NoRedirect(noFollow bool) *GHttpClient {
 	g.noRedirect = noFollow
@@ -206,17 +214,49 @@ func (g *GHttpClient) Timeout(timeout time.Duration) *GHttpClient {
 	return g
 }
 
+// setOptionErr keeps the first error met while setting the attributes, it is returned by the next action
+func (g *GHttpClient) setOptionErr(err error) {
+	if g.optionErr == nil {
+		g.optionErr = err
+	}
+}
+
 // prepare checks whether attributes are set, and build a http client
 func (g *GHttpClient) prepare(method string, ctx context.Context) error {
-	if g.url == "" {
+	if g.optionErr != nil {
+		return g.optionErr
+	}
+
+	requestUrl := g.resolveUrl()
+	if requestUrl == "" {
 		return errors.New("URL must be set before sending a request")
 	}
 
-	request, err := http.NewRequestWithContext(ctx, method, g.url, g.body)
+	request, err := http.NewRequestWithContext(ctx, method, requestUrl, g.body)
 	if err != nil {
 		return err
 	}
+	if g.multipart != nil {
+		g.multipart.setBody(request)
+	}
+	if len(g.query) > 0 {
+		if request.URL.RawQuery != "" {
+			request.URL.RawQuery += "&"
+		}
+		request.URL.RawQuery += g.query.Encode()
+	}
 	request.Header = g.header.ToHttpHeader()
+	g.autoDecode = g.acceptEncoding(request)
+	if g.retries(request) {
+		if g.bodyCloser, err = bufferBody(request, g.body); err != nil {
+			return err
+		}
+	}
+	if g.compression != nil {
+		if err := g.compression.compressRequest(request, g.compressMinSize()); err != nil {
+			return err
+		}
+	}
 
 	g.request = request
 
@@ -236,167 +276,238 @@ func (g *GHttpClient) prepare(method string, ctx context.Context) error {
 		}
 	}
 
-	if g.proxy != nil {
-		_transport := Transport.Clone()
-		_transport.Proxy = g.proxy
-		g.client.Transport = _transport
+	if g.tls != nil && (g.roundTripper != nil || DefaultRoundTripper != nil) {
+		return errors.New("TLS options can not be applied to a custom RoundTripper, set them on its transport instead")
+	}
+	if g.roundTripper != nil {
+		g.client.Transport = g.roundTripper
+	} else if DefaultRoundTripper != nil {
+		g.client.Transport = DefaultRoundTripper
 	} else {
-		g.client.Transport = Transport
+		transport := Transport
+		if g.tls != nil {
+			transport = g.tls.transport(Transport)
+			if len(g.tls.pins) > 0 && g.tls.pinReportOnly {
+				g.request = g.reportPins(g.request)
+			}
+		}
+		if g.proxy != nil {
+			transport = transport.Clone()
+			transport.Proxy = g.proxy
+		}
+		g.client.Transport = transport
+	}
+
+	if g.dump != nil {
+		g.client.Transport = g.dump.wrap(g.client.Transport, g.getRedactor())
 	}
 
 	return nil
 }
 
-// send do send the request
+// resolveUrl joins the url to the base url, unless the url is absolute
+func (g *GHttpClient) resolveUrl() string {
+	if g.baseUrl == "" || isAbsUrl(g.url) {
+		return g.url
+	}
+	if g.url == "" {
+		return g.baseUrl
+	}
+	if strings.HasPrefix(g.url, "?") {
+		return strings.TrimRight(g.baseUrl, "/") + g.url
+	}
+	return strings.TrimRight(g.baseUrl, "/") + "/" + strings.TrimLeft(g.url, "/")
+}
+
+// isAbsUrl tells whether the url has a scheme or a host, such as http://host/path or //host/path
+func isAbsUrl(rawUrl string) bool {
+	if strings.HasPrefix(rawUrl, "//") {
+		return true
+	}
+	u, err := url.Parse(rawUrl)
+	return err == nil && u.IsAbs()
+}
+
+// clone returns a copy of the client with its own headers and middlewares, which has not sent any request
+func (g *GHttpClient) clone() *GHttpClient {
+	c := *g
+	c.header = make(header.GHttpHeader)
+	c.Headers(g.header)
+	c.middlewares = append([]Middleware(nil), g.middlewares...)
+	c.expectStatus = append([]int(nil), g.expectStatus...)
+	if g.query != nil {
+		c.query = make(url.Values, len(g.query))
+		for key, values := range g.query {
+			c.query[key] = append([]string(nil), values...)
+		}
+	}
+	c.tls = g.tls.clone()
+	if g.tracer != nil {
+		c.tracer = &tracer{}
+	}
+	c.request, c.client, c.response, c.err, c.bodyCloser = nil, nil, nil, nil, nil
+	return &c
+}
+
+// send do send the request, and retries it as the retry policy allows
 func (g *GHttpClient) send() *GHttpClient {
-	if g.debug {
-		g.startTime = time.Now()
-		g.LogDebug("S")
+	g.logEvent(Event{Kind: EventRequest, Attempt: 1})
+	collector := g.getCollector()
+	if collector != nil {
+		collector.RequestStarted(g.metricsLabels(false))
+	}
+	policy := g.retryPolicy
+	if !g.retries(g.request) {
+		policy = nil
+	}
+	roundTrip := g.chain(g.client.Do)
+	request := g.request
+	attempt := 1
+	for ; ; attempt++ {
+		request = request.WithContext(context.WithValue(request.Context(), attemptKey{}, attempt))
+		if g.tracer != nil {
+			request = g.tracer.attach(request)
+		}
+		g.response, g.err = roundTrip(g.trackUpload(request))
+		if policy == nil {
+			break
+		}
+		wait, retry := policy.next(attempt, request, g.response, g.err)
+		if policy.OnAttempt != nil {
+			policy.OnAttempt(attempt, g.response, g.err, wait)
+		}
+		if !retry {
+			break
+		}
+		g.logEvent(Event{Kind: EventRetry, Attempt: attempt, Wait: wait, Err: g.err})
+		discardResponse(g.response)
+		if !sleepContext(request.Context(), wait) {
+			g.response, g.err = nil, request.Context().Err()
+			break
+		}
+		if request, g.err = rewindRequest(g.request); g.err != nil {
+			g.response = nil
+			break
+		}
+	}
+	g.closeBody()
+	if g.err != nil && g.tls != nil {
+		fillPinningHost(g.err)
+	}
+	// the progress of the download is tracked before decoding, in the bytes of Content-Length
+	if g.err == nil {
+		g.trackDownload(g.response)
+	}
+	if g.err == nil && g.autoDecode {
+		decodeResponse(g.response)
+	}
+	if g.err == nil && g.tracer != nil {
+		g.tracer.wrapBody(g.response)
 	}
-	g.response, g.err = g.client.Do(g.request)
-	if g.debug {
-		g.LogDebug("R")
+	if g.err == nil && g.unexpectedStatus(g.response.StatusCode) {
+		g.err = newStatusError(g.request, g.response)
+	}
+	if collector != nil {
+		g.observe(collector, attempt)
+	}
+	if g.err != nil {
+		g.logEvent(Event{Kind: EventError, Attempt: attempt, Err: g.err})
+	} else {
+		g.logEvent(Event{Kind: EventResponse, Attempt: attempt})
 	}
 
 	return g
 }
 
-// Head sends the Request with HEAD method
-func (g *GHttpClient) Head() *GHttpClient {
-	g.err = g.prepare("HEAD", context.Background())
+// closeBody closes the body replayed by seeking, once the request is sent
+func (g *GHttpClient) closeBody() {
+	if g.bodyCloser != nil {
+		g.bodyCloser.Close()
+		g.bodyCloser = nil
+	}
+}
+
+// do prepares the request with the method, then sends it
+func (g *GHttpClient) do(method string, ctx context.Context) *GHttpClient {
+	g.request, g.response, g.startTime = nil, nil, time.Now()
+	g.err = g.prepare(method, ctx)
 	if g.err != nil {
+		g.closeBody()
+		g.logEvent(Event{Kind: EventError, Err: g.err})
 		return g
 	}
 
 	return g.send()
 }
 
+// Head sends the Request with HEAD method
+func (g *GHttpClient) Head() *GHttpClient {
+	return g.do("HEAD", context.Background())
+}
+
 // HeadWithContext
 func (g *GHttpClient) HeadWithContext(ctx context.Context) *GHttpClient {
-	g.err = g.prepare("HEAD", ctx)
-	if g.err != nil {
-		return g
-	}
-
-	return g.send()
+	return g.do("HEAD", ctx)
 }
 
 // Get sends the Request with GET method
 func (g *GHttpClient) Get() *GHttpClient {
-	g.err = g.prepare("GET", context.Background())
-	if g.err != nil {
-		return g
-	}
-
-	return g.send()
+	return g.do("GET", context.Background())
 }
 
 // GetWithContext
 func (g *GHttpClient) GetWithContext(ctx context.Context) *GHttpClient {
-	g.err = g.prepare("GET", ctx)
-	if g.err != nil {
-		return g
-	}
-
-	return g.send()
+	return g.do("GET", ctx)
 }
 
 // Post sends the Request with POST method
 func (g *GHttpClient) Post() *GHttpClient {
-	g.err = g.prepare("POST", context.Background())
-	if g.err != nil {
-		return g
-	}
-
-	return g.send()
+	return g.do("POST", context.Background())
 }
 
 // PostWithContext
 func (g *GHttpClient) PostWithContext(ctx context.Context) *GHttpClient {
-	g.err = g.prepare("POST", ctx)
-	if g.err != nil {
-		return g
-	}
-
-	return g.send()
+	return g.do("POST", ctx)
 }
 
 // Put sends the Request with PUT method
 func (g *GHttpClient) Put() *GHttpClient {
-	g.err = g.prepare("PUT", context.Background())
-	if g.err != nil {
-		return g
-	}
-
-	return g.send()
+	return g.do("PUT", context.Background())
 }
 
 // PutWithContext
 func (g *GHttpClient) PutWithContext(ctx context.Context) *GHttpClient {
-	g.err = g.prepare("PUT", ctx)
-	if g.err != nil {
-		return g
-	}
-
-	return g.send()
+	return g.do("PUT", ctx)
 }
 
 // Patch sends the Request with PATCH method
 func (g *GHttpClient) Patch() *GHttpClient {
-	g.err = g.prepare("PATCH", context.Background())
-	if g.err != nil {
-		return g
-	}
-
-	return g.send()
+	return g.do("PATCH", context.Background())
 }
 
 // Patch sends the Request with PATCH method
 func (g *GHttpClient) PatchWithContext(ctx context.Context) *GHttpClient {
-	g.err = g.prepare("PATCH", ctx)
-	if g.err != nil {
-		return g
-	}
-
-	return g.send()
+	return g.do("PATCH", ctx)
 }
 
 // Delete sends the Request with DELETE method
 func (g *GHttpClient) Delete() *GHttpClient {
-	g.err = g.prepare("DELETE", context.Background())
-	if g.err != nil {
-		return g
-	}
-	return g.send()
+	return g.do("DELETE", context.Background())
 }
 
 // DeleteWithContext
 func (g *GHttpClient) DeleteWithContext(ctx context.Context) *GHttpClient {
-	g.err = g.prepare("DELETE", ctx)
-	if g.err != nil {
-		return g
-	}
-	return g.send()
+	return g.do("DELETE", ctx)
 }
 
 // Options sends the Request with OPTIONS method
 func (g *GHttpClient) Options() *GHttpClient {
-	g.err = g.prepare("OPTIONS", context.Background())
-	if g.err != nil {
-		return g
-	}
-
-	return g.send()
+	return g.do("OPTIONS", context.Background())
 }
 
 // OptionsWithContext
 func (g *GHttpClient) OptionsWithContext(ctx context.Context) *GHttpClient {
-	g.err = g.prepare("OPTIONS", ctx)
-	if g.err != nil {
-		return g
-	}
-
-	return g.send()
+	return g.do("OPTIONS", ctx)
 }
 
 // Response returns http.Response and error
@@ -405,35 +516,43 @@ func (g *GHttpClient) Response() (*http.Response, error) {
 }
 
 // ReadBodyClose fetches the response Body, then close the Body
-// supports gzip content-type
+// supports the content codings of the registered decompressors
 func (g *GHttpClient) ReadBodyClose() ([]byte, error) {
-	if g.debug {
-		defer g.LogDebug("E")
-	}
 	if g.err != nil {
 		return []byte{}, g.err
 	}
-	return ReadBodyClose(g.response)
+	defer g.countBody()()
+	return readBodyClose(g.response, g.maxBodySize)
 }
 
 // TryUTF8ReadBodyClose tries to transfer the body bytes to utf-8 bytes when the body bytes is not in utf-8 encoding
 func (g *GHttpClient) TryUTF8ReadBodyClose() ([]byte, error) {
-	if g.debug {
-		defer g.LogDebug("E")
-	}
 	if g.err != nil {
 		return []byte{}, g.err
 	}
-	return TryUTF8ReadBodyClose(g.response)
+	defer g.countBody()()
+	return tryUTF8ReadBodyClose(g.response, g.maxBodySize)
 }
 
 // ReadJsonClose fetches the response Body and try to decode as a json, then close the Body
 func (g *GHttpClient) ReadJsonClose(v interface{}) error {
-	if g.debug {
-		defer g.LogDebug("E")
-	}
 	if g.err != nil {
 		return g.err
 	}
-	return ReadJsonClose(g.response, v)
+	defer g.countBody()()
+	return readJsonClose(g.response, v, g.maxBodySize)
+}
+
+// countBody counts the bytes read from the response body,
+// the returned function logs the end of body reading with the count and reports it to the metrics collector
+func (g *GHttpClient) countBody() func() {
+	body := &countingBody{ReadCloser: g.response.Body}
+	g.response.Body = body
+	start := time.Now()
+	return func() {
+		g.logEvent(Event{Kind: EventBodyRead, Bytes: body.n})
+		if collector := g.getCollector(); collector != nil {
+			collector.BodyRead(g.metricsLabels(true), body.n, time.Since(start))
+		}
+	}
 }
@@ -0,0 +1,72 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient
+
+import (
+	"github.com/panwenbin/ghttpclient/metrics"
+	"time"
+)
+
+// DefaultMetrics is the metrics collector of the clients without Metrics, nil collects nothing
+var DefaultMetrics metrics.Collector
+
+// DefaultMetricsRoute is the route template function of the clients without one
+var DefaultMetricsRoute metrics.RouteFunc = metrics.DefaultRoute
+
+// Metrics sets the metrics collector of the client, and the function mapping urls to route labels,
+// DefaultMetricsRoute if route is nil
+func (g *GHttpClient) Metrics(collector metrics.Collector, route metrics.RouteFunc) *GHttpClient {
+	g.collector = collector
+	g.route = route
+	return g
+}
+
+// getCollector returns the metrics collector of the client, or DefaultMetrics
+func (g *GHttpClient) getCollector() metrics.Collector {
+	if g.collector != nil {
+		return g.collector
+	}
+	return DefaultMetrics
+}
+
+// metricsLabels returns the labels of the request, with the status class once the request has finished
+func (g *GHttpClient) metricsLabels(finished bool) metrics.Labels {
+	route := g.route
+	if route == nil {
+		route = DefaultMetricsRoute
+	}
+	labels := metrics.Labels{
+		Host:   g.request.URL.Host,
+		Method: g.request.Method,
+		Route:  route(g.request.URL),
+	}
+	if finished {
+		statusCode := 0
+		if g.response != nil {
+			statusCode = g.response.StatusCode
+		}
+		labels.StatusClass = metrics.StatusClass(statusCode)
+	}
+	return labels
+}
+
+// observe reports the end of the request to the collector
+func (g *GHttpClient) observe(collector metrics.Collector, attempts int) {
+	observation := metrics.Observation{
+		Labels:   g.metricsLabels(true),
+		Duration: time.Since(g.startTime),
+		Attempts: attempts,
+	}
+	if g.tracer != nil {
+		timings := g.tracer.timings()
+		observation.Phases = &metrics.Phases{
+			DNSLookup:       timings.DNSLookup,
+			TCPConnect:      timings.TCPConnect,
+			TLSHandshake:    timings.TLSHandshake,
+			TimeToFirstByte: timings.TimeToFirstByte,
+			ConnReused:      timings.ConnReused,
+		}
+	}
+	collector.RequestFinished(observation)
+}
@@ -0,0 +1,146 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds in seconds of the latency histogram buckets
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Series are the metrics of the requests with the same labels
+type Series struct {
+	// Count is the number of finished requests
+	Count int64
+	// Sum is the total duration of the finished requests
+	Sum time.Duration
+	// Buckets are the cumulative counts of the requests not slower than the upper bounds of the collector
+	Buckets []int64
+	// BodyReads is the number of bodies read, and BodyBytes the total of their bytes
+	BodyReads int64
+	BodyBytes int64
+}
+
+// clone returns a copy of the series
+func (s *Series) clone() Series {
+	c := *s
+	c.Buckets = append([]int64(nil), s.Buckets...)
+	return c
+}
+
+// Memory is a Collector keeping the metrics in memory
+type Memory struct {
+	mu       sync.Mutex
+	buckets  []float64
+	series   map[Labels]*Series
+	inFlight map[Labels]int64
+}
+
+// NewMemory returns a Memory collector with the latency histogram upper bounds in seconds,
+// DefaultBuckets when no bound is given
+func NewMemory(buckets ...float64) *Memory {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Memory{
+		buckets:  buckets,
+		series:   make(map[Labels]*Series),
+		inFlight: make(map[Labels]int64),
+	}
+}
+
+// RequestStarted implements Collector
+func (m *Memory) RequestStarted(labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight[labels]++
+}
+
+// RequestFinished implements Collector
+func (m *Memory) RequestFinished(observation Observation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	inFlight := observation.Labels
+	inFlight.StatusClass = ""
+	if m.inFlight[inFlight]--; m.inFlight[inFlight] <= 0 {
+		delete(m.inFlight, inFlight)
+	}
+
+	series := m.getSeries(observation.Labels)
+	series.Count++
+	series.Sum += observation.Duration
+	seconds := observation.Duration.Seconds()
+	for i, bound := range m.buckets {
+		if seconds <= bound {
+			series.Buckets[i]++
+		}
+	}
+}
+
+// BodyRead implements Collector
+func (m *Memory) BodyRead(labels Labels, bytes int64, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	series := m.getSeries(labels)
+	series.BodyReads++
+	series.BodyBytes += bytes
+}
+
+// getSeries returns the series of the labels, it is created if missing
+func (m *Memory) getSeries(labels Labels) *Series {
+	series, ok := m.series[labels]
+	if !ok {
+		series = &Series{Buckets: make([]int64, len(m.buckets))}
+		m.series[labels] = series
+	}
+	return series
+}
+
+// Buckets returns the upper bounds in seconds of the latency histogram buckets
+func (m *Memory) Buckets() []float64 {
+	return append([]float64(nil), m.buckets...)
+}
+
+// Series returns a copy of the series of the labels
+func (m *Memory) Series(labels Labels) Series {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	series, ok := m.series[labels]
+	if !ok {
+		return Series{Buckets: make([]int64, len(m.buckets))}
+	}
+	return series.clone()
+}
+
+// Snapshot returns a copy of all the series
+func (m *Memory) Snapshot() map[Labels]Series {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshot := make(map[Labels]Series, len(m.series))
+	for labels, series := range m.series {
+		snapshot[labels] = series.clone()
+	}
+	return snapshot
+}
+
+// InFlight returns the number of requests in flight with the labels, whose status class is ignored
+func (m *Memory) InFlight(labels Labels) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	labels.StatusClass = ""
+	return m.inFlight[labels]
+}
+
+// Reset removes all the metrics
+func (m *Memory) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.series = make(map[Labels]*Series)
+	m.inFlight = make(map[Labels]int64)
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+// Package metrics defines the collector of the request metrics of ghttpclient,
+// and provides an in-memory collector
+package metrics
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Labels are the labels of the metrics of a request
+type Labels struct {
+	Host   string
+	Method string
+	// Route is the route template of the url, see RouteFunc
+	Route string
+	// StatusClass is "2xx", "4xx"... or "error" when there is no response, empty for a request in flight
+	StatusClass string
+}
+
+// Phases are the connection phase durations of a traced request
+type Phases struct {
+	DNSLookup       time.Duration
+	TCPConnect      time.Duration
+	TLSHandshake    time.Duration
+	TimeToFirstByte time.Duration
+	ConnReused      bool
+}
+
+// Observation is the result of a finished request
+type Observation struct {
+	Labels Labels
+	// Duration is the time from the start of the request to the response, retries included
+	Duration time.Duration
+	Attempts int
+	// Phases are the phases of the last attempt, nil if the client does not trace
+	Phases *Phases
+}
+
+// Collector receives the metrics of requests
+type Collector interface {
+	// RequestStarted is called when a request starts, the labels have no status class
+	RequestStarted(labels Labels)
+	// RequestFinished is called when a started request gets its response or fails
+	RequestFinished(observation Observation)
+	// BodyRead is called when the body of a response has been read
+	BodyRead(labels Labels, bytes int64, duration time.Duration)
+}
+
+// StatusClass returns the status class of a status code, "error" for 0
+func StatusClass(statusCode int) string {
+	if statusCode <= 0 {
+		return "error"
+	}
+	return strconv.Itoa(statusCode/100) + "xx"
+}
+
+// RouteFunc maps the url of a request to a route template, so that the label count stays bounded
+type RouteFunc func(u *url.URL) string
+
+// IDSegment replaces the id-like path segments in DefaultRoute
+const IDSegment = ":id"
+
+var (
+	uuidSegment  = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hexSegment   = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+	tokenSegment = regexp.MustCompile(`^[0-9A-Za-z_-]{20,}$`)
+	digits       = regexp.MustCompile(`[0-9]`)
+)
+
+// DefaultRoute returns the path of the url without the query, whose numeric, UUID, long hex
+// and long token segments are replaced by IDSegment, e.g. /users/42/orders becomes /users/:id/orders
+func DefaultRoute(u *url.URL) string {
+	segments := strings.Split(u.Path, "/")
+	for i, segment := range segments {
+		if isID(segment) {
+			segments[i] = IDSegment
+		}
+	}
+	route := strings.Join(segments, "/")
+	if route == "" {
+		return "/"
+	}
+	return route
+}
+
+// isID checks whether a path segment looks like an id
+func isID(segment string) bool {
+	if segment == "" {
+		return false
+	}
+	if _, err := strconv.ParseUint(segment, 10, 64); err == nil {
+		return true
+	}
+	return uuidSegment.MatchString(segment) || hexSegment.MatchString(segment) ||
+		(tokenSegment.MatchString(segment) && digits.MatchString(segment))
+}
@@ -0,0 +1,77 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package metrics_test
+
+import (
+	"github.com/panwenbin/ghttpclient/metrics"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestDefaultRoute(t *testing.T) {
+	cases := map[string]string{
+		"http://example.com":                                            "/",
+		"http://example.com/users/42/orders?page=2":                     "/users/:id/orders",
+		"http://example.com/items/3f2b8c1e-4a5d-4e6f-9a0b-1c2d3e4f5a6b": "/items/:id",
+		"http://example.com/blobs/0123456789abcdef0123/raw":             "/blobs/:id/raw",
+		"http://example.com/share/aB3dE5gH7jK9mN1pQ3sT5v":               "/share/:id",
+		"http://example.com/v2/healthcheck-status-page/":                "/v2/healthcheck-status-page/",
+	}
+	for rawUrl, expect := range cases {
+		u, err := url.Parse(rawUrl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if route := metrics.DefaultRoute(u); route != expect {
+			t.Errorf("expect %s, got %s for %s", expect, route, rawUrl)
+		}
+	}
+}
+
+func TestStatusClass(t *testing.T) {
+	for statusCode, expect := range map[int]string{0: "error", 200: "2xx", 404: "4xx", 503: "5xx"} {
+		if class := metrics.StatusClass(statusCode); class != expect {
+			t.Errorf("expect %s, got %s", expect, class)
+		}
+	}
+}
+
+func TestMemory(t *testing.T) {
+	memory := metrics.NewMemory(0.1, 1)
+	labels := metrics.Labels{Host: "example.com", Method: "GET", Route: "/users/:id"}
+
+	memory.RequestStarted(labels)
+	memory.RequestStarted(labels)
+	if inFlight := memory.InFlight(labels); inFlight != 2 {
+		t.Errorf("expect 2 requests in flight, got %d", inFlight)
+	}
+
+	labels.StatusClass = "2xx"
+	memory.RequestFinished(metrics.Observation{Labels: labels, Duration: 50 * time.Millisecond, Attempts: 1})
+	memory.RequestFinished(metrics.Observation{Labels: labels, Duration: 500 * time.Millisecond, Attempts: 1})
+	memory.BodyRead(labels, 11, time.Millisecond)
+	if inFlight := memory.InFlight(labels); inFlight != 0 {
+		t.Errorf("expect no request in flight, got %d", inFlight)
+	}
+
+	series := memory.Series(labels)
+	if series.Count != 2 || series.Sum != 550*time.Millisecond {
+		t.Errorf("expect 2 requests in 550ms, got %d in %s", series.Count, series.Sum)
+	}
+	if len(series.Buckets) != 2 || series.Buckets[0] != 1 || series.Buckets[1] != 2 {
+		t.Errorf("expect cumulative buckets [1 2], got %v", series.Buckets)
+	}
+	if series.BodyReads != 1 || series.BodyBytes != 11 {
+		t.Errorf("expect 1 body of 11 bytes, got %d of %d bytes", series.BodyReads, series.BodyBytes)
+	}
+	if len(memory.Snapshot()) != 1 {
+		t.Errorf("expect 1 series, got %d", len(memory.Snapshot()))
+	}
+
+	memory.Reset()
+	if series := memory.Series(labels); series.Count != 0 {
+		t.Errorf("expect no request after reset, got %d", series.Count)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+// Package prometheus registers the request metrics of ghttpclient to a Prometheus registry
+package prometheus
+
+import (
+	"github.com/panwenbin/ghttpclient/metrics"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// Options are the options of New
+type Options struct {
+	// Namespace prefixes the metric names, "ghttpclient" if empty
+	Namespace string
+	// Buckets are the upper bounds in seconds of the duration histograms, metrics.DefaultBuckets if empty
+	Buckets []float64
+	// ConstLabels are added to all the metrics
+	ConstLabels prom.Labels
+}
+
+// Collector is a metrics.Collector exporting Prometheus metrics
+type Collector struct {
+	requests  *prom.CounterVec
+	durations *prom.HistogramVec
+	inFlight  *prom.GaugeVec
+	bodyBytes *prom.CounterVec
+	phases    *prom.HistogramVec
+}
+
+// New returns a Collector whose metrics are registered to the registerer, prom.DefaultRegisterer if nil:
+// requests_total, request_duration_seconds, requests_in_flight, response_body_bytes_total,
+// and request_phase_duration_seconds for the clients which Trace
+func New(registerer prom.Registerer, opts *Options) (*Collector, error) {
+	if registerer == nil {
+		registerer = prom.DefaultRegisterer
+	}
+	if opts == nil {
+		opts = &Options{}
+	}
+	namespace := opts.Namespace
+	if namespace == "" {
+		namespace = "ghttpclient"
+	}
+	buckets := opts.Buckets
+	if len(buckets) == 0 {
+		buckets = metrics.DefaultBuckets
+	}
+	labels := []string{"host", "method", "route", "status_class"}
+	c := &Collector{
+		requests: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace, Name: "requests_total", ConstLabels: opts.ConstLabels,
+			Help: "Number of finished requests.",
+		}, labels),
+		durations: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: namespace, Name: "request_duration_seconds", ConstLabels: opts.ConstLabels, Buckets: buckets,
+			Help: "Duration of the requests until the response, retries included.",
+		}, labels),
+		inFlight: prom.NewGaugeVec(prom.GaugeOpts{
+			Namespace: namespace, Name: "requests_in_flight", ConstLabels: opts.ConstLabels,
+			Help: "Number of requests waiting for their response.",
+		}, labels[:3]),
+		bodyBytes: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace, Name: "response_body_bytes_total", ConstLabels: opts.ConstLabels,
+			Help: "Number of response body bytes read.",
+		}, labels),
+		phases: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: namespace, Name: "request_phase_duration_seconds", ConstLabels: opts.ConstLabels, Buckets: buckets,
+			Help: "Duration of the connection phases of the traced requests.",
+		}, []string{"host", "method", "route", "phase"}),
+	}
+	for _, collector := range []prom.Collector{c.requests, c.durations, c.inFlight, c.bodyBytes, c.phases} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// MustNew is like New but panics if the metrics can not be registered
+func MustNew(registerer prom.Registerer, opts *Options) *Collector {
+	c, err := New(registerer, opts)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// RequestStarted implements metrics.Collector
+func (c *Collector) RequestStarted(labels metrics.Labels) {
+	c.inFlight.WithLabelValues(labels.Host, labels.Method, labels.Route).Inc()
+}
+
+// RequestFinished implements metrics.Collector
+func (c *Collector) RequestFinished(observation metrics.Observation) {
+	l := observation.Labels
+	c.inFlight.WithLabelValues(l.Host, l.Method, l.Route).Dec()
+	c.requests.WithLabelValues(l.Host, l.Method, l.Route, l.StatusClass).Inc()
+	c.durations.WithLabelValues(l.Host, l.Method, l.Route, l.StatusClass).Observe(observation.Duration.Seconds())
+
+	phases := observation.Phases
+	if phases == nil {
+		return
+	}
+	if !phases.ConnReused {
+		c.phases.WithLabelValues(l.Host, l.Method, l.Route, "dns_lookup").Observe(phases.DNSLookup.Seconds())
+		c.phases.WithLabelValues(l.Host, l.Method, l.Route, "tcp_connect").Observe(phases.TCPConnect.Seconds())
+		c.phases.WithLabelValues(l.Host, l.Method, l.Route, "tls_handshake").Observe(phases.TLSHandshake.Seconds())
+	}
+	c.phases.WithLabelValues(l.Host, l.Method, l.Route, "ttfb").Observe(phases.TimeToFirstByte.Seconds())
+}
+
+// BodyRead implements metrics.Collector
+func (c *Collector) BodyRead(labels metrics.Labels, bytes int64, duration time.Duration) {
+	c.bodyBytes.WithLabelValues(labels.Host, labels.Method, labels.Route, labels.StatusClass).Add(float64(bytes))
+}
@@ -0,0 +1,59 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package prometheus_test
+
+import (
+	"github.com/panwenbin/ghttpclient"
+	"github.com/panwenbin/ghttpclient/metrics/prometheus"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCollector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ghttpclient"))
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	registry := prom.NewRegistry()
+	collector := prometheus.MustNew(registry, &prometheus.Options{Namespace: "test"})
+	template := ghttpclient.NewTemplate().BaseUrl(server.URL).Metrics(collector, nil).Trace()
+	for _, id := range []string{"1", "2"} {
+		if _, err := template.R().Url("/users/" + id).Get().ReadBodyClose(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expect := `
+# HELP test_requests_total Number of finished requests.
+# TYPE test_requests_total counter
+test_requests_total{host="` + host + `",method="GET",route="/users/:id",status_class="2xx"} 2
+# HELP test_response_body_bytes_total Number of response body bytes read.
+# TYPE test_response_body_bytes_total counter
+test_response_body_bytes_total{host="` + host + `",method="GET",route="/users/:id",status_class="2xx"} 22
+# HELP test_requests_in_flight Number of requests waiting for their response.
+# TYPE test_requests_in_flight gauge
+test_requests_in_flight{host="` + host + `",method="GET",route="/users/:id"} 0
+`
+	err := testutil.GatherAndCompare(registry, strings.NewReader(expect),
+		"test_requests_total", "test_response_body_bytes_total", "test_requests_in_flight")
+	if err != nil {
+		t.Error(err)
+	}
+	if count := testutil.CollectAndCount(registry, "test_request_duration_seconds"); count != 1 {
+		t.Errorf("expect 1 duration histogram, got %d", count)
+	}
+	if count := testutil.CollectAndCount(registry, "test_request_phase_duration_seconds"); count != 4 {
+		t.Errorf("expect 4 phase histograms, got %d", count)
+	}
+
+	if _, err := prometheus.New(registry, &prometheus.Options{Namespace: "test"}); err == nil {
+		t.Error("expect an error registering the metrics twice")
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient_test
+
+import (
+	"github.com/panwenbin/ghttpclient"
+	"github.com/panwenbin/ghttpclient/metrics"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/missing") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("ghttpclient"))
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	memory := metrics.NewMemory()
+	template := ghttpclient.NewTemplate().BaseUrl(server.URL).Metrics(memory, nil).Trace()
+	for _, id := range []string{"1", "2"} {
+		if _, err := template.R().Url("/users/" + id).Get().ReadBodyClose(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	template.R().Url("/users/3/missing").Get().ReadBodyClose()
+
+	ok := memory.Series(metrics.Labels{Host: host, Method: "GET", Route: "/users/:id", StatusClass: "2xx"})
+	if ok.Count != 2 || ok.BodyReads != 2 || ok.BodyBytes != int64(2*len("ghttpclient")) {
+		t.Errorf("expect 2 requests with 2 bodies of 22 bytes, got %d with %d bodies of %d bytes", ok.Count, ok.BodyReads, ok.BodyBytes)
+	}
+	missing := memory.Series(metrics.Labels{Host: host, Method: "GET", Route: "/users/:id/missing", StatusClass: "4xx"})
+	if missing.Count != 1 {
+		t.Errorf("expect 1 request, got %d", missing.Count)
+	}
+	if len(memory.Snapshot()) != 2 {
+		t.Errorf("expect 2 series, got %d", len(memory.Snapshot()))
+	}
+
+	memory.Reset()
+	ghttpclient.NewClient().Url("http://127.0.0.1:1/users/1").
+		Metrics(memory, func(u *url.URL) string { return "users" }).Get()
+	failed := memory.Series(metrics.Labels{Host: "127.0.0.1:1", Method: "GET", Route: "users", StatusClass: "error"})
+	if failed.Count != 1 {
+		t.Errorf("expect 1 failed request, got %d", failed.Count)
+	}
+	if inFlight := memory.InFlight(metrics.Labels{Host: "127.0.0.1:1", Method: "GET", Route: "users"}); inFlight != 0 {
+		t.Errorf("expect no request in flight, got %d", inFlight)
+	}
+}
+
+func TestDefaultMetrics(t *testing.T) {
+	server := newEchoServer(t)
+	memory := metrics.NewMemory()
+	ghttpclient.DefaultMetrics = memory
+	defer func() { ghttpclient.DefaultMetrics = nil }()
+
+	if _, err := ghttpclient.Get(server.URL+"/ghttpclient", nil).ReadBodyClose(); err != nil {
+		t.Fatal(err)
+	}
+	if len(memory.Snapshot()) != 1 {
+		t.Errorf("expect 1 series, got %d", len(memory.Snapshot()))
+	}
+}
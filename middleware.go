@@ -0,0 +1,68 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// RoundTripFunc sends a request and returns its response
+type RoundTripFunc func(request *http.Request) (*http.Response, error)
+
+// Middleware wraps a RoundTripFunc, it may change the request before calling next,
+// and inspect or replace the response and error returned by next
+type Middleware func(next RoundTripFunc) RoundTripFunc
+
+var (
+	middlewaresMu sync.RWMutex
+	middlewares   []Middleware
+)
+
+// Use registers middlewares for all clients
+// package middlewares run before the middlewares of a client, each group in registration order
+func Use(middleware ...Middleware) {
+	middlewaresMu.Lock()
+	defer middlewaresMu.Unlock()
+	middlewares = append(middlewares, middleware...)
+}
+
+// ResetMiddlewares removes all the middlewares registered by Use
+func ResetMiddlewares() {
+	middlewaresMu.Lock()
+	defer middlewaresMu.Unlock()
+	middlewares = nil
+}
+
+// Use registers middlewares for the client, they run in registration order for each attempt of a request
+func (g *GHttpClient) Use(middleware ...Middleware) *GHttpClient {
+	g.middlewares = append(g.middlewares, middleware...)
+	return g
+}
+
+// chain wraps the round trip with the package middlewares and the client middlewares,
+// the first registered middleware is the outermost one
+func (g *GHttpClient) chain(roundTrip RoundTripFunc) RoundTripFunc {
+	middlewaresMu.RLock()
+	all := make([]Middleware, 0, len(middlewares)+len(g.middlewares))
+	all = append(all, middlewares...)
+	middlewaresMu.RUnlock()
+	all = append(all, g.middlewares...)
+
+	for i := len(all) - 1; i >= 0; i-- {
+		roundTrip = all[i](roundTrip)
+	}
+	return roundTrip
+}
+
+// attemptKey is the context key of the attempt number
+type attemptKey struct{}
+
+// AttemptFromContext returns the number of the attempt, starting from 1, of the request whose context is ctx,
+// so that middlewares can tell retries apart. It returns 0 for a context which is not the one of an attempt.
+func AttemptFromContext(ctx context.Context) int {
+	attempt, _ := ctx.Value(attemptKey{}).(int)
+	return attempt
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient_test
+
+import (
+	"fmt"
+	"github.com/panwenbin/ghttpclient"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Trace")))
+	}))
+	defer server.Close()
+
+	var order []string
+	mark := func(name string) ghttpclient.Middleware {
+		return func(next ghttpclient.RoundTripFunc) ghttpclient.RoundTripFunc {
+			return func(request *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				request.Header.Add("X-Trace", name)
+				response, err := next(request)
+				if err == nil {
+					response.Header.Set("X-Seen-By-"+name, "1")
+				}
+				return response, err
+			}
+		}
+	}
+
+	ghttpclient.Use(mark("package"))
+	defer ghttpclient.ResetMiddlewares()
+
+	client := ghttpclient.NewClient().Url(server.URL).Use(mark("first"), mark("second")).Get()
+	response, err := client.Response()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Header.Get("X-Seen-By-package") != "1" {
+		t.Error("expect the response to pass through the package middleware")
+	}
+	body, err := client.ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(order, ",") != "package,first,second" {
+		t.Errorf("expect package,first,second, got %s", strings.Join(order, ","))
+	}
+	if string(body) != "package" {
+		t.Errorf("expect package, got %s", body)
+	}
+}
+
+func TestAttemptFromContext(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	var attempts []int
+	recordAttempt := func(next ghttpclient.RoundTripFunc) ghttpclient.RoundTripFunc {
+		return func(request *http.Request) (*http.Response, error) {
+			attempts = append(attempts, ghttpclient.AttemptFromContext(request.Context()))
+			return next(request)
+		}
+	}
+
+	policy := ghttpclient.NewRetryPolicy()
+	policy.MinBackoff = time.Millisecond
+	_, err := ghttpclient.NewClient().Url(server.URL).Retry(policy).Use(recordAttempt).Get().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(attempts) != "[1 2 3]" {
+		t.Errorf("expect attempts [1 2 3], got %v", attempts)
+	}
+}
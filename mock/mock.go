@@ -0,0 +1,295 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+// Package mock provides an in-process http.RoundTripper for testing code built on ghttpclient
+//
+//	m := mock.New(t)
+//	m.Expect("GET", "/users/*").Respond(200, `{"name":"ghttpclient"}`)
+//	body, err := ghttpclient.NewClient().RoundTripper(m).Url("http://api/users/1").Get().ReadBodyClose()
+package mock
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/panwenbin/ghttpclient"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoMatch is returned for a request which matches no expectation
+var ErrNoMatch = errors.New("mock: no expectation matches the request")
+
+// TestingT is the part of testing.TB used by Transport
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Cleanup(func())
+}
+
+// Request is a request recorded by Transport
+type Request struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   []byte
+}
+
+// Transport is a programmable http.RoundTripper
+// Requests are matched against the expectations in registration order
+type Transport struct {
+	t            TestingT
+	mu           sync.Mutex
+	expectations []*Expectation
+	requests     []*Request
+}
+
+// New returns a new Transport, it checks that every expectation is used when the test ends
+func New(t TestingT) *Transport {
+	m := &Transport{t: t}
+	t.Cleanup(m.AssertExpectations)
+	return m
+}
+
+// Install makes the Transport send the requests of all ghttpclient clients until the test ends
+func (m *Transport) Install() *Transport {
+	previous := ghttpclient.DefaultRoundTripper
+	ghttpclient.DefaultRoundTripper = m
+	m.t.Cleanup(func() {
+		ghttpclient.DefaultRoundTripper = previous
+	})
+	return m
+}
+
+// Expect registers an expectation for requests with the method and a url matching the pattern
+// An empty method matches any method. In the pattern, * matches any characters.
+// A pattern containing :// is matched against the full url, otherwise against the path,
+// and against the path and query when it contains ?
+func (m *Transport) Expect(method, urlPattern string) *Expectation {
+	e := &Expectation{
+		method:     strings.ToUpper(method),
+		urlPattern: urlPattern,
+		urlRegexp:  globRegexp(urlPattern),
+		header:     make(http.Header),
+		times:      -1,
+		status:     http.StatusOK,
+		respHeader: make(http.Header),
+	}
+	m.mu.Lock()
+	m.expectations = append(m.expectations, e)
+	m.mu.Unlock()
+	return e
+}
+
+// Requests returns all the requests sent through the Transport
+func (m *Transport) Requests() []*Request {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*Request(nil), m.requests...)
+}
+
+// AssertExpectations reports every expectation which has not been used as expected
+func (m *Transport) AssertExpectations() {
+	m.t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.expectations {
+		if e.times < 0 && e.calls == 0 {
+			m.t.Errorf("mock: expectation %s %s is never used", e.method, e.urlPattern)
+		} else if e.times >= 0 && e.calls != e.times {
+			m.t.Errorf("mock: expectation %s %s is used %d times, %d expected", e.method, e.urlPattern, e.calls, e.times)
+		}
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (m *Transport) RoundTrip(request *http.Request) (*http.Response, error) {
+	recorded := &Request{
+		Method: request.Method,
+		URL:    request.URL.String(),
+		Header: request.Header.Clone(),
+	}
+	// the request is not modified, the handler reads the body recorded from a clone
+	served := request
+	if request.Body != nil {
+		body, err := ioutil.ReadAll(request.Body)
+		request.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		recorded.Body = body
+		served = request.Clone(request.Context())
+		served.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	m.mu.Lock()
+	m.requests = append(m.requests, recorded)
+	var matched *Expectation
+	for _, e := range m.expectations {
+		if e.matches(served, recorded.Body) {
+			matched = e
+			e.calls++
+			break
+		}
+	}
+	m.mu.Unlock()
+
+	if matched == nil {
+		m.t.Helper()
+		m.t.Errorf("mock: unexpected request %s %s", recorded.Method, recorded.URL)
+		return nil, fmt.Errorf("%w: %s %s", ErrNoMatch, recorded.Method, recorded.URL)
+	}
+	return matched.respond(served)
+}
+
+// Expectation describes the requests it matches and the response they get
+type Expectation struct {
+	method      string
+	urlPattern  string
+	urlRegexp   *regexp.Regexp
+	header      http.Header
+	bodyMatcher func(body []byte) bool
+	times       int
+	calls       int
+
+	status     int
+	respHeader http.Header
+	respBody   []byte
+	err        error
+	delay      time.Duration
+	handler    func(request *http.Request) (*http.Response, error)
+}
+
+// Header makes the expectation match only requests with the header value
+func (e *Expectation) Header(key, value string) *Expectation {
+	e.header.Add(key, value)
+	return e
+}
+
+// Body makes the expectation match only requests whose body is accepted by the matcher
+func (e *Expectation) Body(matcher func(body []byte) bool) *Expectation {
+	e.bodyMatcher = matcher
+	return e
+}
+
+// BodyString makes the expectation match only requests with exactly the body
+func (e *Expectation) BodyString(body string) *Expectation {
+	return e.Body(func(b []byte) bool {
+		return string(b) == body
+	})
+}
+
+// Times makes the expectation match exactly n requests, by default it matches any number of requests but at least one
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+// Respond sets the status code and body of the response
+func (e *Expectation) Respond(statusCode int, body string) *Expectation {
+	e.status = statusCode
+	e.respBody = []byte(body)
+	return e
+}
+
+// RespondHeader sets a header of the response
+func (e *Expectation) RespondHeader(key, value string) *Expectation {
+	e.respHeader.Set(key, value)
+	return e
+}
+
+// RespondFunc lets a function build the response
+func (e *Expectation) RespondFunc(handler func(request *http.Request) (*http.Response, error)) *Expectation {
+	e.handler = handler
+	return e
+}
+
+// Error makes the round trip fail with err
+func (e *Expectation) Error(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// Delay waits before responding, or until the request context is done
+func (e *Expectation) Delay(delay time.Duration) *Expectation {
+	e.delay = delay
+	return e
+}
+
+// matches checks whether the request is matched by the expectation
+func (e *Expectation) matches(request *http.Request, body []byte) bool {
+	if e.times >= 0 && e.calls >= e.times {
+		return false
+	}
+	if e.method != "" && e.method != request.Method {
+		return false
+	}
+
+	target := request.URL.Path
+	if strings.Contains(e.urlPattern, "://") {
+		target = request.URL.String()
+	} else if strings.Contains(e.urlPattern, "?") {
+		target = request.URL.RequestURI()
+	}
+	if !e.urlRegexp.MatchString(target) {
+		return false
+	}
+
+	for key, values := range e.header {
+		for _, value := range values {
+			found := false
+			for _, v := range request.Header.Values(key) {
+				if v == value {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+
+	return e.bodyMatcher == nil || e.bodyMatcher(body)
+}
+
+// respond returns the programmed response or error
+func (e *Expectation) respond(request *http.Request) (*http.Response, error) {
+	if e.delay > 0 {
+		timer := time.NewTimer(e.delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-request.Context().Done():
+			return nil, request.Context().Err()
+		}
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	if e.handler != nil {
+		return e.handler(request)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.status, http.StatusText(e.status)),
+		StatusCode:    e.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.respHeader.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(e.respBody)),
+		ContentLength: int64(len(e.respBody)),
+		Request:       request,
+	}, nil
+}
+
+// globRegexp converts a pattern where * matches any characters to a regexp
+func globRegexp(pattern string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(pattern)
+	return regexp.MustCompile("^" + strings.Replace(quoted, `\*`, ".*", -1) + "$")
+}
@@ -0,0 +1,133 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package mock_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/panwenbin/ghttpclient"
+	"github.com/panwenbin/ghttpclient/mock"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeT records the errors reported by a Transport
+type fakeT struct {
+	errors   []string
+	cleanups []func()
+}
+
+func (f *fakeT) Helper() {}
+
+func (f *fakeT) Errorf(format string, args ...interface{}) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeT) Cleanup(fn func()) {
+	f.cleanups = append(f.cleanups, fn)
+}
+
+func TestTransport(t *testing.T) {
+	m := mock.New(t)
+	m.Expect("POST", "/users/*").Header("X-Team", "core").BodyString("ghttpclient").
+		Respond(201, "created").RespondHeader("Content-Type", "text/plain")
+
+	body, err := ghttpclient.NewClient().RoundTripper(m).Url("http://api.example/users/1").
+		Header("X-Team", "core").Body(strings.NewReader("ghttpclient")).Post().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "created" {
+		t.Errorf("expect created, got %s", body)
+	}
+
+	requests := m.Requests()
+	if len(requests) != 1 || requests[0].URL != "http://api.example/users/1" || string(requests[0].Body) != "ghttpclient" {
+		t.Errorf("unexpected recorded requests %v", requests)
+	}
+}
+
+func TestTransportInstall(t *testing.T) {
+	m := mock.New(t).Install()
+	m.Expect("GET", "http://api.example/*").Times(2).Respond(200, "ghttpclient")
+
+	for i := 0; i < 2; i++ {
+		body, err := ghttpclient.Get("http://api.example/ping", nil).ReadBodyClose()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != "ghttpclient" {
+			t.Errorf("expect ghttpclient, got %s", body)
+		}
+	}
+}
+
+func TestTransportErrorAndDelay(t *testing.T) {
+	m := mock.New(t)
+	failure := errors.New("connection refused")
+	m.Expect("GET", "/error").Error(failure)
+	m.Expect("GET", "/slow").Delay(time.Second)
+
+	_, err := ghttpclient.NewClient().RoundTripper(m).Url("http://api.example/error").Get().Response()
+	if !errors.Is(err, failure) {
+		t.Errorf("expect %s, got %v", failure, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = ghttpclient.NewClient().RoundTripper(m).Url("http://api.example/slow").GetWithContext(ctx).Response()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expect %s, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestTransportUnmatchedAndUnused(t *testing.T) {
+	f := &fakeT{}
+	m := mock.New(f)
+	m.Expect("GET", "/used")
+	m.Expect("GET", "/unused")
+
+	ghttpclient.NewClient().RoundTripper(m).Url("http://api.example/used").Get().ReadBodyClose()
+	_, err := ghttpclient.NewClient().RoundTripper(m).Url("http://api.example/other").Get().Response()
+	if !errors.Is(err, mock.ErrNoMatch) {
+		t.Errorf("expect ErrNoMatch, got %v", err)
+	}
+	for _, fn := range f.cleanups {
+		fn()
+	}
+
+	if len(f.errors) != 2 {
+		t.Fatalf("expect 2 errors, got %v", f.errors)
+	}
+	if !strings.Contains(f.errors[0], "/other") || !strings.Contains(f.errors[1], "/unused") {
+		t.Errorf("unexpected errors %v", f.errors)
+	}
+}
+
+func TestTransportKeepsRequest(t *testing.T) {
+	m := mock.New(t)
+	m.Expect("POST", "/echo").RespondFunc(func(request *http.Request) (*http.Response, error) {
+		body, _ := ioutil.ReadAll(request.Body)
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewReader(body)), Request: request}, nil
+	})
+
+	body := ioutil.NopCloser(strings.NewReader("ghttpclient"))
+	request, _ := http.NewRequest("POST", "http://api.example/echo", body)
+	response, err := m.RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	echoed, _ := ioutil.ReadAll(response.Body)
+	if string(echoed) != "ghttpclient" {
+		t.Errorf("expect the handler to read the body, got %s", echoed)
+	}
+	if request.Body != body {
+		t.Error("expect the request not to be modified")
+	}
+}
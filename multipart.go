@@ -0,0 +1,267 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Multipart builds a multipart/form-data body which is streamed while the request is sent, see GHttpClient.Multipart
+type Multipart struct {
+	client   *GHttpClient
+	boundary string
+	parts    []*multipartPart
+}
+
+// multipartPart is a part of a multipart body
+type multipartPart struct {
+	header textproto.MIMEHeader
+	// open returns the content of the part, it is called again when the body is replayed
+	open func() (io.ReadCloser, error)
+	// replayable tells whether open can be called more than once
+	replayable bool
+	// size is the size of the content, -1 if unknown
+	size     int64
+	progress func(written, total int64)
+}
+
+// Multipart sets the body to a multipart/form-data body, and sets the Content-Type header with its boundary
+// The parts are added to the returned builder, whose Done method returns the client
+// The body is streamed through a pipe when the request is sent, so files are never fully buffered
+func (g *GHttpClient) Multipart() *Multipart {
+	m := &Multipart{
+		client:   g,
+		boundary: multipart.NewWriter(ioutil.Discard).Boundary(),
+	}
+	g.multipart = m
+	g.body = nil
+	g.header.ContentType("multipart/form-data; boundary=" + m.boundary)
+	return m
+}
+
+// Done returns the client to continue the chain
+func (m *Multipart) Done() *GHttpClient {
+	return m.client
+}
+
+// Field adds a form field
+func (m *Multipart) Field(name, value string) *Multipart {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"`, escapeQuotes(name)))
+	m.parts = append(m.parts, &multipartPart{
+		header:     header,
+		open:       func() (io.ReadCloser, error) { return ioutil.NopCloser(strings.NewReader(value)), nil },
+		replayable: true,
+		size:       int64(len(value)),
+	})
+	return m
+}
+
+// File adds a file read from r, its Content-Type is guessed from the extension of the filename
+// r is not closed, and the body can be replayed for retries only if r is an io.Seeker, otherwise the request is not retried
+func (m *Multipart) File(name, filename string, r io.Reader) *Multipart {
+	part := &multipartPart{header: fileHeader(name, filename), size: -1}
+	part.open = func() (io.ReadCloser, error) { return ioutil.NopCloser(r), nil }
+	if seeker, ok := r.(io.Seeker); ok {
+		if start, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			if end, err := seeker.Seek(0, io.SeekEnd); err == nil {
+				seeker.Seek(start, io.SeekStart)
+				part.size = end - start
+				part.replayable = true
+				part.open = func() (io.ReadCloser, error) {
+					_, err := seeker.Seek(start, io.SeekStart)
+					return ioutil.NopCloser(r), err
+				}
+			}
+		}
+	}
+	m.parts = append(m.parts, part)
+	return m
+}
+
+// FileFromPath adds the file at the path, which is opened while the request is sent
+// An error reading the file information is returned by the next action of the client
+func (m *Multipart) FileFromPath(name, path string) *Multipart {
+	info, err := os.Stat(path)
+	if err != nil {
+		m.client.setOptionErr(err)
+		return m
+	}
+	m.parts = append(m.parts, &multipartPart{
+		header: fileHeader(name, filepath.Base(path)),
+		open: func() (io.ReadCloser, error) {
+			return os.Open(path)
+		},
+		replayable: true,
+		size:       info.Size(),
+	})
+	return m
+}
+
+// ContentType sets the Content-Type of the last added part
+func (m *Multipart) ContentType(contentType string) *Multipart {
+	return m.Header("Content-Type", contentType)
+}
+
+// Header sets a header of the last added part
+func (m *Multipart) Header(key, value string) *Multipart {
+	if len(m.parts) > 0 {
+		m.parts[len(m.parts)-1].header.Set(key, value)
+	}
+	return m
+}
+
+// OnProgress sets a callback of the last added part, called with the number of bytes written
+// and the size of the part, -1 if unknown
+func (m *Multipart) OnProgress(progress func(written, total int64)) *Multipart {
+	if len(m.parts) > 0 {
+		m.parts[len(m.parts)-1].progress = progress
+	}
+	return m
+}
+
+// replayable tells whether all the parts can be written again
+func (m *Multipart) replayable() bool {
+	for _, part := range m.parts {
+		if !part.replayable {
+			return false
+		}
+	}
+	return true
+}
+
+// size returns the size of the body, -1 if the size of a part is unknown
+func (m *Multipart) size() int64 {
+	counter := &countingWriter{}
+	writer := multipart.NewWriter(counter)
+	writer.SetBoundary(m.boundary)
+	for _, part := range m.parts {
+		if part.size < 0 {
+			return -1
+		}
+		writer.CreatePart(part.header)
+		counter.n += part.size
+	}
+	writer.Close()
+	return counter.n
+}
+
+// setBody sets the body of the request, which can be replayed if all the parts can be
+func (m *Multipart) setBody(request *http.Request) {
+	request.Body = m.body()
+	request.ContentLength = m.size()
+	request.GetBody = nil
+	if m.replayable() {
+		request.GetBody = func() (io.ReadCloser, error) {
+			return m.body(), nil
+		}
+	}
+}
+
+// body returns a reader of the body, the parts are written to a pipe by a goroutine started by the first Read
+func (m *Multipart) body() io.ReadCloser {
+	reader, writer := io.Pipe()
+	return &pipeBody{
+		PipeReader: reader,
+		start: func() {
+			writer.CloseWithError(m.write(writer))
+		},
+	}
+}
+
+// write writes the parts
+func (m *Multipart) write(w io.Writer) error {
+	writer := multipart.NewWriter(w)
+	writer.SetBoundary(m.boundary)
+	for _, part := range m.parts {
+		partWriter, err := writer.CreatePart(part.header)
+		if err != nil {
+			return err
+		}
+		content, err := part.open()
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(&progressWriter{w: partWriter, total: part.size, progress: part.progress}, content)
+		content.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// pipeBody is the reading end of a pipe, whose writer is started by the first Read
+type pipeBody struct {
+	*io.PipeReader
+	once  sync.Once
+	start func()
+}
+
+// Read implements io.Reader
+func (b *pipeBody) Read(p []byte) (int, error) {
+	b.once.Do(func() {
+		go b.start()
+	})
+	return b.PipeReader.Read(p)
+}
+
+// fileHeader returns the header of a file part
+func fileHeader(name, filename string) textproto.MIMEHeader {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition",
+		fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(name), escapeQuotes(filename)))
+	contentType := mime.TypeByExtension(filepath.Ext(filename))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header.Set("Content-Type", contentType)
+	return header
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// escapeQuotes escapes the quotes of a Content-Disposition parameter
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+// countingWriter counts the bytes written
+type countingWriter struct {
+	n int64
+}
+
+// Write implements io.Writer
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// progressWriter reports the bytes written to a callback
+type progressWriter struct {
+	w        io.Writer
+	written  int64
+	total    int64
+	progress func(written, total int64)
+}
+
+// Write implements io.Writer
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.written += int64(n)
+	if w.progress != nil {
+		w.progress(w.written, w.total)
+	}
+	return n, err
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient_test
+
+import (
+	"github.com/panwenbin/ghttpclient"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newMultipartServer returns a server answering the content length and the parts of a multipart request,
+// the requests for which fail returns true get a 503
+func newMultipartServer(t *testing.T, fail func() bool) *httptest.Server {
+	return newFailingServer(t, fail, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader, err := r.MultipartReader()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var parts []string
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			content, _ := ioutil.ReadAll(part)
+			parts = append(parts, part.FormName()+":"+part.FileName()+":"+part.Header.Get("Content-Type")+
+				":"+part.Header.Get("X-Part")+":"+string(content))
+		}
+		w.Write([]byte(strconv.FormatInt(r.ContentLength, 10) + "\n" + strings.Join(parts, "\n")))
+	}))
+}
+
+func TestMultipart(t *testing.T) {
+	server := newMultipartServer(t, nil)
+	var written, total int64
+	body, err := ghttpclient.NewClient().Url(server.URL).Multipart().
+		Field("name", "ghttpclient").
+		File("file", "hello.txt", ioutil.NopCloser(strings.NewReader("hello"))).
+		ContentType("text/x-hello").Header("X-Part", "1").
+		OnProgress(func(w, t int64) { written, total = w, t }).
+		Done().Post().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(body), "\n")
+	if lines[0] != "-1" {
+		t.Errorf("expect an unknown content length, got %s", lines[0])
+	}
+	if strings.Join(lines[1:], "\n") != "name::::ghttpclient\nfile:hello.txt:text/x-hello:1:hello" {
+		t.Errorf("expect the field and the file, got %s", strings.Join(lines[1:], "\n"))
+	}
+	if written != 5 || total != -1 {
+		t.Errorf("expect 5 bytes written of an unknown total, got %d of %d", written, total)
+	}
+}
+
+func TestMultipartFileFromPath(t *testing.T) {
+	server := newMultipartServer(t, failFirst(1))
+	path := filepath.Join(t.TempDir(), "data.json")
+	if err := os.WriteFile(path, []byte(`{"x":1}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := ghttpclient.NewRetryPolicy()
+	policy.MinBackoff = time.Millisecond
+	body, err := ghttpclient.NewClient().Url(server.URL).Retry(policy).Multipart().
+		Field("name", "ghttpclient").
+		FileFromPath("file", path).
+		Done().Put().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(body), "\n")
+	if lines[0] == "-1" {
+		t.Error("expect a known content length")
+	}
+	if len(lines) != 3 || lines[2] != `file:data.json:application/json::{"x":1}` {
+		t.Errorf("expect the file to be replayed, got %s", body)
+	}
+
+	_, err = ghttpclient.NewClient().Url(server.URL).Multipart().
+		FileFromPath("file", filepath.Join(t.TempDir(), "missing")).Done().Post().Response()
+	if !os.IsNotExist(err) {
+		t.Errorf("expect a not exist error, got %v", err)
+	}
+}
+
+func TestMultipartNotReplayable(t *testing.T) {
+	var calls int32
+	server := newMultipartServer(t, func() bool {
+		return atomic.AddInt32(&calls, 1) == 1
+	})
+
+	policy := ghttpclient.NewRetryPolicy()
+	policy.MinBackoff = time.Millisecond
+	response, err := ghttpclient.NewClient().Url(server.URL).Retry(policy).Multipart().
+		File("file", "hello.txt", ioutil.NopCloser(strings.NewReader("hello"))).
+		Done().Put().Response()
+	if response == nil || response.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expect the 503 of the only attempt, got %v, %v", response, err)
+	}
+	if calls != 1 {
+		t.Errorf("expect a body which can not be replayed not to be retried, got %d attempts", calls)
+	}
+	if response.Request.ContentLength != -1 {
+		t.Errorf("expect the body streamed, got a content length of %d", response.Request.ContentLength)
+	}
+}
@@ -0,0 +1,23 @@
+module github.com/panwenbin/ghttpclient/otel
+
+go 1.21
+
+replace github.com/panwenbin/ghttpclient => ..
+
+require (
+	github.com/panwenbin/ghttpclient v1.1.0
+	go.opentelemetry.io/otel v1.24.0
+	go.opentelemetry.io/otel/sdk v1.24.0
+	go.opentelemetry.io/otel/trace v1.24.0
+)
+
+require (
+	github.com/andybalholm/brotli v1.1.0 // indirect
+	github.com/go-logr/logr v1.4.1 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/klauspost/compress v1.17.0 // indirect
+	go.opentelemetry.io/otel/metric v1.24.0 // indirect
+	golang.org/x/net v0.0.0-20190628185345-da137c7871d7 // indirect
+	golang.org/x/sys v0.17.0 // indirect
+	golang.org/x/text v0.3.0 // indirect
+)
@@ -0,0 +1,158 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+// Package otel traces the requests of ghttpclient with OpenTelemetry
+package otel
+
+import (
+	"fmt"
+	"github.com/panwenbin/ghttpclient"
+	otelapi "go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"strconv"
+)
+
+// ScopeName is the instrumentation scope name of the tracer
+const ScopeName = "github.com/panwenbin/ghttpclient/otel"
+
+// config is the configuration of the middleware
+type config struct {
+	tracerProvider trace.TracerProvider
+	propagators    propagation.TextMapPropagator
+	redactor       *ghttpclient.Redactor
+	spanName       func(request *http.Request) string
+}
+
+// Option configures the middleware
+type Option func(c *config)
+
+// WithTracerProvider sets the tracer provider, the global one by default
+func WithTracerProvider(tracerProvider trace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = tracerProvider
+	}
+}
+
+// WithPropagators sets the propagators injecting the trace context, the global ones by default if they are set,
+// or the W3C TraceContext and Baggage ones
+func WithPropagators(propagators propagation.TextMapPropagator) Option {
+	return func(c *config) {
+		c.propagators = propagators
+	}
+}
+
+// WithRedactor sets the redactor of the url.full attribute, ghttpclient.DefaultRedactor by default
+func WithRedactor(redactor *ghttpclient.Redactor) Option {
+	return func(c *config) {
+		c.redactor = redactor
+	}
+}
+
+// WithSpanNameFormatter sets the function naming the spans, the request method by default
+func WithSpanNameFormatter(spanName func(request *http.Request) string) Option {
+	return func(c *config) {
+		c.spanName = spanName
+	}
+}
+
+// Middleware returns a ghttpclient.Middleware starting a client span for each attempt of a request,
+// as a child of the span in the context given to the *WithContext methods.
+// The trace context is injected into the request headers, traceparent, tracestate and baggage with the default propagators.
+// A retried attempt gets its own span, with the http.request.resend_count attribute and a retry event.
+func Middleware(opts ...Option) ghttpclient.Middleware {
+	c := &config{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.tracerProvider == nil {
+		c.tracerProvider = otelapi.GetTracerProvider()
+	}
+	if c.propagators == nil {
+		// the global propagators inject nothing until the application sets them
+		c.propagators = otelapi.GetTextMapPropagator()
+		if len(c.propagators.Fields()) == 0 {
+			c.propagators = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+		}
+	}
+	if c.redactor == nil {
+		c.redactor = ghttpclient.DefaultRedactor
+	}
+	if c.spanName == nil {
+		c.spanName = func(request *http.Request) string {
+			return request.Method
+		}
+	}
+	tracer := c.tracerProvider.Tracer(ScopeName)
+
+	return func(next ghttpclient.RoundTripFunc) ghttpclient.RoundTripFunc {
+		return func(request *http.Request) (*http.Response, error) {
+			ctx, span := tracer.Start(request.Context(), c.spanName(request),
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(c.requestAttributes(request)...))
+			defer span.End()
+			if attempt := ghttpclient.AttemptFromContext(ctx); attempt > 1 {
+				span.AddEvent("retry", trace.WithAttributes(attribute.Int("attempt", attempt)))
+			}
+
+			// the request is cloned, so that the injected headers do not leak into the next attempt
+			request = request.Clone(ctx)
+			c.propagators.Inject(ctx, propagation.HeaderCarrier(request.Header))
+
+			response, err := next(request)
+			if err != nil {
+				span.SetAttributes(semconv.ErrorTypeKey.String(fmt.Sprintf("%T", err)))
+				// the error may hold the url with its secrets
+				redacted := c.redactor.RedactError(err)
+				span.RecordError(redacted)
+				span.SetStatus(codes.Error, redacted.Error())
+				return response, err
+			}
+			span.SetAttributes(semconv.HTTPResponseStatusCode(response.StatusCode))
+			if response.StatusCode >= http.StatusBadRequest {
+				span.SetAttributes(semconv.ErrorTypeKey.String(strconv.Itoa(response.StatusCode)))
+				span.SetStatus(codes.Error, "")
+			}
+			return response, nil
+		}
+	}
+}
+
+// requestAttributes returns the semantic convention attributes of the request
+func (c *config) requestAttributes(request *http.Request) []attribute.KeyValue {
+	u := *request.URL
+	u.User = nil
+	attributes := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(request.Method),
+		semconv.URLFull(c.redactor.RedactURL(u.String())),
+		semconv.ServerAddress(request.URL.Hostname()),
+	}
+	if port := serverPort(request); port > 0 {
+		attributes = append(attributes, semconv.ServerPort(port))
+	}
+	if userAgent := request.UserAgent(); userAgent != "" {
+		attributes = append(attributes, semconv.UserAgentOriginal(userAgent))
+	}
+	if attempt := ghttpclient.AttemptFromContext(request.Context()); attempt > 1 {
+		attributes = append(attributes, semconv.HTTPRequestResendCount(attempt-1))
+	}
+	return attributes
+}
+
+// serverPort returns the port of the url, or the default port of its scheme
+func serverPort(request *http.Request) int {
+	if port, err := strconv.Atoi(request.URL.Port()); err == nil {
+		return port
+	}
+	switch request.URL.Scheme {
+	case "http":
+		return 80
+	case "https":
+		return 443
+	}
+	return 0
+}
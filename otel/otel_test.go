@@ -0,0 +1,145 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package otel_test
+
+import (
+	"context"
+	"github.com/panwenbin/ghttpclient"
+	"github.com/panwenbin/ghttpclient/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// attributeValue returns the value of the attribute of the span, empty if missing
+func attributeValue(span tracetest.SpanStub, key attribute.Key) string {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestMiddleware(t *testing.T) {
+	var calls int32
+	var traceparents []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents = append(traceparents, r.Header.Get("traceparent"))
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ghttpclient"))
+	}))
+	defer server.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+
+	policy := ghttpclient.NewRetryPolicy()
+	policy.MinBackoff = time.Millisecond
+	middleware := otel.Middleware(otel.WithTracerProvider(provider), otel.WithPropagators(propagation.TraceContext{}))
+	_, err := ghttpclient.NewClient().Url(server.URL + "/users?api_key=secret").Retry(policy).Use(middleware).
+		GetWithContext(ctx).ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("expect 3 spans, got %d", len(spans))
+	}
+	first, second := spans[0], spans[1]
+	for i, span := range []tracetest.SpanStub{first, second} {
+		if span.Name != "GET" || span.Parent.SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("expect a GET span child of the parent, got %s child of %s", span.Name, span.Parent.SpanID())
+		}
+		if !strings.Contains(traceparents[i], span.SpanContext.SpanID().String()) {
+			t.Errorf("expect the traceparent of span %s, got %s", span.SpanContext.SpanID(), traceparents[i])
+		}
+	}
+	if value := attributeValue(first, "http.response.status_code"); value != "503" {
+		t.Errorf("expect 503, got %s", value)
+	}
+	if first.Status.Code != codes.Error {
+		t.Errorf("expect an error status, got %s", first.Status.Code)
+	}
+	if value := attributeValue(first, "url.full"); strings.Contains(value, "secret") {
+		t.Errorf("expect a redacted url, got %s", value)
+	}
+	if value := attributeValue(second, "http.request.resend_count"); value != "1" {
+		t.Errorf("expect a resend count of 1, got %s", value)
+	}
+	if len(second.Events) != 1 || second.Events[0].Name != "retry" {
+		t.Errorf("expect a retry event, got %v", second.Events)
+	}
+	if second.Status.Code != codes.Unset {
+		t.Errorf("expect an unset status, got %s", second.Status.Code)
+	}
+}
+
+func TestMiddlewareDefaultPropagators(t *testing.T) {
+	var traceparent, baggageHeader string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent, baggageHeader = r.Header.Get("traceparent"), r.Header.Get("baggage")
+	}))
+	defer server.Close()
+
+	provider := sdktrace.NewTracerProvider()
+	member, _ := baggage.NewMember("tenant", "ghttpclient")
+	bag, _ := baggage.New(member)
+	ctx := baggage.ContextWithBaggage(context.Background(), bag)
+	_, err := ghttpclient.NewClient().Url(server.URL).Use(otel.Middleware(otel.WithTracerProvider(provider))).
+		GetWithContext(ctx).ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if traceparent == "" {
+		t.Error("expect a traceparent header with the default propagators")
+	}
+	if baggageHeader != "tenant=ghttpclient" {
+		t.Errorf("expect tenant=ghttpclient, got %s", baggageHeader)
+	}
+}
+
+func TestMiddlewareError(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	_, err := ghttpclient.NewClient().Url("http://127.0.0.1:1/?access_token=secret").
+		Use(otel.Middleware(otel.WithTracerProvider(provider))).Get().Response()
+	if err == nil {
+		t.Fatal("expect an error")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expect 1 span, got %d", len(spans))
+	}
+	if spans[0].Status.Code != codes.Error || len(spans[0].Events) != 1 || spans[0].Events[0].Name != "exception" {
+		t.Errorf("expect an error status with an exception event, got %s with %v", spans[0].Status.Code, spans[0].Events)
+	}
+	if value := attributeValue(spans[0], "server.port"); value != "1" {
+		t.Errorf("expect 1, got %s", value)
+	}
+	message := spans[0].Status.Description
+	for _, kv := range spans[0].Events[0].Attributes {
+		message += " " + kv.Value.Emit()
+	}
+	if strings.Contains(message, "secret") || !strings.Contains(message, ghttpclient.RedactedValue) {
+		t.Errorf("expect the url of the error redacted, got %s", message)
+	}
+}
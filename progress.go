@@ -0,0 +1,115 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// DefaultProgressInterval is the minimum interval between two calls of a progress callback
+var DefaultProgressInterval = 100 * time.Millisecond
+
+// OnUploadProgress sets a callback receiving the number of request body bytes sent for each attempt,
+// and the total from Content-Length, -1 if unknown
+// It is called at most once per progress interval, and once more when the body is fully sent
+func (g *GHttpClient) OnUploadProgress(progress func(sent, total int64)) *GHttpClient {
+	g.onUpload = progress
+	return g
+}
+
+// OnDownloadProgress sets a callback receiving the number of response body bytes received,
+// and the total from Content-Length, -1 if unknown. A compressed body decoded by the client is counted in compressed bytes,
+// a body decoded by the transport, see NoAcceptEncoding, is counted in decoded bytes of an unknown total
+// It is called at most once per progress interval, and once more when the body is fully received
+func (g *GHttpClient) OnDownloadProgress(progress func(received, total int64)) *GHttpClient {
+	g.onDownload = progress
+	return g
+}
+
+// ProgressInterval sets the minimum interval between two calls of a progress callback,
+// DefaultProgressInterval by default, 0 calls it on every read
+func (g *GHttpClient) ProgressInterval(interval time.Duration) *GHttpClient {
+	g.progressEvery = &interval
+	return g
+}
+
+// getProgressInterval returns the progress interval of the client, or DefaultProgressInterval
+func (g *GHttpClient) getProgressInterval() time.Duration {
+	if g.progressEvery != nil {
+		return *g.progressEvery
+	}
+	return DefaultProgressInterval
+}
+
+// trackUpload returns a copy of the request whose body reports its progress
+func (g *GHttpClient) trackUpload(request *http.Request) *http.Request {
+	if g.onUpload == nil || request.Body == nil || request.Body == http.NoBody {
+		return request
+	}
+	total := request.ContentLength
+	if total <= 0 {
+		total = -1
+	}
+	tracked := *request
+	tracked.Body = newProgressReader(request.Body, total, g.getProgressInterval(), g.onUpload)
+	return &tracked
+}
+
+// trackDownload makes the body of the response report its progress
+func (g *GHttpClient) trackDownload(response *http.Response) {
+	if g.onDownload == nil || response.Body == nil || response.Body == http.NoBody {
+		return
+	}
+	response.Body = newProgressReader(response.Body, response.ContentLength, g.getProgressInterval(), g.onDownload)
+}
+
+// progressReporter counts the bytes transferred, and calls a callback at most once per interval
+type progressReporter struct {
+	n        int64
+	total    int64
+	interval time.Duration
+	last     time.Time
+	reported int64
+	progress func(transferred, total int64)
+}
+
+// newProgressReporter returns a progressReporter starting from n bytes
+func newProgressReporter(n, total int64, interval time.Duration, progress func(transferred, total int64)) *progressReporter {
+	return &progressReporter{n: n, total: total, interval: interval, reported: -1, progress: progress}
+}
+
+// add counts n more bytes, the callback is called if the interval has elapsed since the last call,
+// or if the transfer is done
+func (r *progressReporter) add(n int64, done bool) {
+	r.n += n
+	if r.n == r.reported {
+		return
+	}
+	now := time.Now()
+	if !done && r.n != r.total && now.Sub(r.last) < r.interval {
+		return
+	}
+	r.last, r.reported = now, r.n
+	r.progress(r.n, r.total)
+}
+
+// progressReader reports the bytes read to a callback
+type progressReader struct {
+	io.ReadCloser
+	reporter *progressReporter
+}
+
+// newProgressReader returns a progressReader of r
+func newProgressReader(r io.ReadCloser, total int64, interval time.Duration, progress func(transferred, total int64)) *progressReader {
+	return &progressReader{ReadCloser: r, reporter: newProgressReporter(0, total, interval, progress)}
+}
+
+// Read implements io.Reader
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.reporter.add(int64(n), err == io.EOF)
+	return n, err
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/panwenbin/ghttpclient"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestUploadProgress(t *testing.T) {
+	server := newEchoServer(t)
+	content := bytes.Repeat([]byte("ghttpclient"), 100000)
+
+	var calls int
+	var sent, total int64
+	_, err := ghttpclient.NewClient().Url(server.URL).Body(bytes.NewReader(content)).ProgressInterval(0).
+		OnUploadProgress(func(s, t int64) {
+			calls++
+			sent, total = s, t
+		}).Post().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent != int64(len(content)) || total != int64(len(content)) {
+		t.Errorf("expect %d of %d bytes sent, got %d of %d", len(content), len(content), sent, total)
+	}
+	if calls < 2 {
+		t.Errorf("expect several calls, got %d", calls)
+	}
+}
+
+func TestDownloadProgress(t *testing.T) {
+	content := bytes.Repeat([]byte("ghttpclient"), 100000)
+	compressed := &bytes.Buffer{}
+	gzWriter := gzip.NewWriter(compressed)
+	gzWriter.Write(content)
+	gzWriter.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Length", strconv.Itoa(compressed.Len()))
+		for i := 0; i < compressed.Len(); i += 512 {
+			end := i + 512
+			if end > compressed.Len() {
+				end = compressed.Len()
+			}
+			w.Write(compressed.Bytes()[i:end])
+			w.(http.Flusher).Flush()
+			time.Sleep(time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	var calls int
+	var received, total int64
+	body, err := ghttpclient.NewClient().Url(server.URL).Header("Accept-Encoding", "gzip").
+		ProgressInterval(time.Hour).
+		OnDownloadProgress(func(r, t int64) {
+			calls++
+			received, total = r, t
+		}).Get().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(body, content) {
+		t.Errorf("expect %d decoded bytes, got %d", len(content), len(body))
+	}
+	if received != int64(compressed.Len()) || total != int64(compressed.Len()) {
+		t.Errorf("expect %d of %d bytes received, got %d of %d", compressed.Len(), compressed.Len(), received, total)
+	}
+	if calls != 2 {
+		t.Errorf("expect a first call and a last call, got %d calls", calls)
+	}
+
+	body, err = ghttpclient.NewClient().Url(server.URL).OnDownloadProgress(func(r, t int64) {
+		received, total = r, t
+	}).Get().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(body, content) {
+		t.Errorf("expect %d decoded bytes with the default Accept-Encoding, got %d", len(content), len(body))
+	}
+	if received != int64(compressed.Len()) || total != int64(compressed.Len()) {
+		t.Errorf("expect %d of %d bytes received with the default Accept-Encoding, got %d of %d",
+			compressed.Len(), compressed.Len(), received, total)
+	}
+
+	_, err = ghttpclient.NewClient().Url(server.URL).NoAcceptEncoding(true).OnDownloadProgress(func(r, t int64) {
+		received, total = r, t
+	}).Get().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received != int64(len(content)) || total != -1 {
+		t.Errorf("expect %d bytes decoded by the transport of an unknown total, got %d of %d", len(content), received, total)
+	}
+}
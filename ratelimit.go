@@ -0,0 +1,222 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RequestLimiter limits the rate of the requests sent
+type RequestLimiter interface {
+	// Wait blocks until the request may be sent, it returns the error of the request context if it ends before
+	Wait(request *http.Request) error
+	// Observe adapts the limiter to the response of a request
+	Observe(response *http.Response)
+}
+
+// RateLimitMiddleware returns a Middleware waiting for the limiter before each attempt of a request
+// Use(RateLimitMiddleware(limiter)) limits the requests of all clients
+func RateLimitMiddleware(limiter RequestLimiter) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(request *http.Request) (*http.Response, error) {
+			if err := limiter.Wait(request); err != nil {
+				return nil, err
+			}
+			response, err := next(request)
+			if err == nil {
+				limiter.Observe(response)
+			}
+			return response, err
+		}
+	}
+}
+
+// RateLimit limits the rate of the requests of the client, a limiter shared by clients or templates limits them together
+func (g *GHttpClient) RateLimit(limiter RequestLimiter) *GHttpClient {
+	return g.Use(RateLimitMiddleware(limiter))
+}
+
+// RateLimiter is a token bucket RequestLimiter, refilled at a rate of tokens per second up to a burst of tokens
+type RateLimiter struct {
+	// Adaptive pauses the requests as the Retry-After header of a 429 or 503 response asks,
+	// or until X-RateLimit-Reset once X-RateLimit-Remaining is 0
+	Adaptive bool
+
+	mu     sync.Mutex
+	rate   float64
+	burst  int
+	tokens float64
+	// last is the time of the last refill, it is in the future while the limiter is paused
+	last time.Time
+}
+
+// NewRateLimiter returns a RateLimiter allowing rate requests per second, and bursts of burst requests
+// A rate of 0 or less means no limit
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{rate: rate, burst: burst, tokens: float64(burst), last: time.Now()}
+}
+
+// Wait implements RequestLimiter
+func (l *RateLimiter) Wait(request *http.Request) error {
+	return l.WaitContext(request.Context())
+}
+
+// WaitContext blocks until a token is available, it returns the error of the context if it ends before,
+// or an error matching context.DeadlineExceeded at once if the deadline of the context is before the token is available
+func (l *RateLimiter) WaitContext(ctx context.Context) error {
+	now := time.Now()
+	l.mu.Lock()
+	wait := l.reserve(now)
+	l.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(now.Add(wait)) {
+		l.cancel()
+		return rateLimitDeadlineError{}
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.cancel()
+		return ctx.Err()
+	}
+}
+
+// Observe implements RequestLimiter
+func (l *RateLimiter) Observe(response *http.Response) {
+	if l.Adaptive {
+		if until, ok := pauseUntil(response); ok {
+			l.PauseUntil(until)
+		}
+	}
+}
+
+// PauseUntil holds the requests until the time, then lets them through at the rate
+func (l *RateLimiter) PauseUntil(until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until.After(l.last) {
+		l.last = until
+		l.tokens = 1
+	}
+}
+
+// reserve takes a token and returns the wait until it is available, the lock must be held
+func (l *RateLimiter) reserve(now time.Time) time.Duration {
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens += elapsed.Seconds() * l.rate
+		if l.tokens > float64(l.burst) {
+			l.tokens = float64(l.burst)
+		}
+		l.last = now
+	}
+	wait := l.last.Sub(now)
+	if l.rate <= 0 {
+		return wait
+	}
+	l.tokens--
+	if l.tokens < 0 {
+		wait += time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	return wait
+}
+
+// cancel gives back the token of a request which will not be sent
+func (l *RateLimiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate > 0 {
+		l.tokens++
+	}
+}
+
+// rateLimitDeadlineError is returned when the deadline of a context is before a token is available,
+// it is a context.DeadlineExceeded which is not retried
+type rateLimitDeadlineError struct{}
+
+// Error implements the error interface
+func (rateLimitDeadlineError) Error() string {
+	return "rate limit wait exceeds the context deadline"
+}
+
+// Is makes the error match context.DeadlineExceeded
+func (rateLimitDeadlineError) Is(target error) bool {
+	return target == context.DeadlineExceeded
+}
+
+// HostRateLimiter is a RequestLimiter with a RateLimiter per host
+type HostRateLimiter struct {
+	// Adaptive pauses the requests to a host as its responses ask, as RateLimiter.Adaptive
+	Adaptive bool
+
+	mu       sync.Mutex
+	rate     float64
+	burst    int
+	limiters map[string]*RateLimiter
+}
+
+// NewHostRateLimiter returns a HostRateLimiter allowing rate requests per second, and bursts of burst requests, to each host
+func NewHostRateLimiter(rate float64, burst int) *HostRateLimiter {
+	return &HostRateLimiter{rate: rate, burst: burst, limiters: make(map[string]*RateLimiter)}
+}
+
+// Limiter returns the RateLimiter of a host, created on first use
+func (h *HostRateLimiter) Limiter(host string) *RateLimiter {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	limiter, ok := h.limiters[host]
+	if !ok {
+		limiter = NewRateLimiter(h.rate, h.burst)
+		h.limiters[host] = limiter
+	}
+	return limiter
+}
+
+// Wait implements RequestLimiter
+func (h *HostRateLimiter) Wait(request *http.Request) error {
+	return h.Limiter(request.URL.Host).Wait(request)
+}
+
+// Observe implements RequestLimiter
+func (h *HostRateLimiter) Observe(response *http.Response) {
+	if !h.Adaptive || response.Request == nil {
+		return
+	}
+	if until, ok := pauseUntil(response); ok {
+		h.Limiter(response.Request.URL.Host).PauseUntil(until)
+	}
+}
+
+// pauseUntil returns the time until which a response asks to pause the requests,
+// from Retry-After for a 429 or 503 response, or from X-RateLimit-Reset once X-RateLimit-Remaining is 0
+func pauseUntil(response *http.Response) (time.Time, bool) {
+	if response.StatusCode == http.StatusTooManyRequests || response.StatusCode == http.StatusServiceUnavailable {
+		if wait, ok := parseRetryAfter(response.Header.Get("Retry-After")); ok {
+			return time.Now().Add(wait), true
+		}
+	}
+	if response.Header.Get("X-RateLimit-Remaining") != "0" {
+		return time.Time{}, false
+	}
+	reset, err := strconv.ParseInt(response.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil || reset < 0 {
+		return time.Time{}, false
+	}
+	// a reset larger than a year of seconds is a unix time, otherwise a number of seconds
+	if reset > 365*24*3600 {
+		return time.Unix(reset, 0), true
+	}
+	return time.Now().Add(time.Duration(reset) * time.Second), true
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient_test
+
+import (
+	"context"
+	"errors"
+	"github.com/panwenbin/ghttpclient"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	server := newEchoServer(t)
+	limiter := ghttpclient.NewRateLimiter(20, 2)
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if _, err := ghttpclient.NewClient().Url(server.URL).RateLimit(limiter).Get().ReadBodyClose(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("expect 2 requests to wait for 50ms each, got %s", elapsed)
+	}
+
+	var calls int32
+	server = newFailingServer(t, func() bool {
+		atomic.AddInt32(&calls, 1)
+		return false
+	}, http.HandlerFunc(echo))
+	// the next token of the limiter is available in a minute, after the deadline
+	limiter = ghttpclient.NewRateLimiter(1.0/60, 1)
+	limiter.WaitContext(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := ghttpclient.NewClient().Url(server.URL).RateLimit(limiter).Retry(ghttpclient.NewRetryPolicy()).
+		GetWithContext(ctx).Response()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expect a deadline exceeded error, got %v", err)
+	}
+	if ctx.Err() != nil || atomic.LoadInt32(&calls) != 0 {
+		t.Errorf("expect to fail without waiting for the deadline nor sending a request, got %v and %d requests",
+			ctx.Err(), atomic.LoadInt32(&calls))
+	}
+}
+
+func TestTemplateAndHostRateLimiter(t *testing.T) {
+	server1, server2 := newEchoServer(t), newEchoServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	api := ghttpclient.NewTemplate().RateLimit(ghttpclient.NewHostRateLimiter(1.0/60, 1))
+	for _, url := range []string{server1.URL, server2.URL} {
+		if _, err := api.R().Url(url).GetWithContext(ctx).ReadBodyClose(); err != nil {
+			t.Fatalf("expect a token for each host, got %v", err)
+		}
+	}
+	_, err := api.R().Url(server1.URL).GetWithContext(ctx).Response()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expect the clients of the template to share the limiter, got %v", err)
+	}
+}
+
+func TestAdaptiveRateLimiter(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", "60")
+		}
+	}))
+	defer server.Close()
+
+	for _, header := range []string{"Retry-After", "X-RateLimit-Reset"} {
+		limiter := ghttpclient.NewRateLimiter(1000, 10)
+		limiter.Adaptive = true
+		ghttpclient.NewClient().Url(server.URL).RateLimit(limiter).Get().ReadBodyClose()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		_, err := ghttpclient.NewClient().Url(server.URL).RateLimit(limiter).GetWithContext(ctx).Response()
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: expect the limiter to pause, got %v", header, err)
+		}
+	}
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("expect 2 requests, got %d", atomic.LoadInt32(&calls))
+	}
+}
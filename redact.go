@@ -0,0 +1,244 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// RedactedValue replaces the redacted values
+const RedactedValue = "[REDACTED]"
+
+// DefaultRedactor is the redactor of the clients without a Redactor
+var DefaultRedactor = NewRedactor()
+
+// Redactor hides secrets in headers, urls and JSON bodies before they are logged or dumped
+type Redactor struct {
+	mu          sync.RWMutex
+	headers     []*regexp.Regexp
+	queryParams []*regexp.Regexp
+	jsonPaths   [][]string
+}
+
+// NewRedactor returns a Redactor which redacts the Authorization, Proxy-Authorization, Cookie, Set-Cookie
+// and X-Api-Key headers, and the access_token, api_key and password query parameters
+func NewRedactor() *Redactor {
+	return (&Redactor{}).
+		Headers("Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key").
+		QueryParams("access_token", "api_key", "password")
+}
+
+// Headers adds patterns of header names to redact, a pattern is a case-insensitive regexp matching the whole name
+// It panics if a pattern is not a valid regexp
+func (r *Redactor) Headers(patterns ...string) *Redactor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, pattern := range patterns {
+		r.headers = append(r.headers, regexp.MustCompile("(?i)^(?:"+pattern+")$"))
+	}
+	return r
+}
+
+// QueryParams adds patterns of query parameter names to redact, a pattern is a case-insensitive regexp matching the whole name
+// It panics if a pattern is not a valid regexp
+func (r *Redactor) QueryParams(patterns ...string) *Redactor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, pattern := range patterns {
+		r.queryParams = append(r.queryParams, regexp.MustCompile("(?i)^(?:"+pattern+")$"))
+	}
+	return r
+}
+
+// JSONPaths adds paths of JSON body values to redact, such as "password", "user.token" or "items.*.secret"
+// A * segment matches any key, and arrays are walked through element by element
+func (r *Redactor) JSONPaths(paths ...string) *Redactor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, path := range paths {
+		path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+		r.jsonPaths = append(r.jsonPaths, strings.Split(path, "."))
+	}
+	return r
+}
+
+// RedactHeader returns a copy of the header with the values of the redacted headers replaced
+func (r *Redactor) RedactHeader(httpHeader http.Header) http.Header {
+	if httpHeader == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	redacted := httpHeader.Clone()
+	for key, values := range redacted {
+		if matchAny(r.headers, key) {
+			for i := range values {
+				values[i] = RedactedValue
+			}
+		}
+	}
+	return redacted
+}
+
+// RedactURL returns the url with the password of the user info and the values of the redacted query parameters replaced
+func (r *Redactor) RedactURL(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+	return r.redactURL(u).String()
+}
+
+// redactURL returns a copy of the url with the secrets replaced
+func (r *Redactor) redactURL(u *url.URL) *url.URL {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	redacted := *u
+	if _, hasPassword := u.User.Password(); hasPassword {
+		redacted.User = url.UserPassword(u.User.Username(), RedactedValue)
+	}
+	if u.RawQuery == "" || len(r.queryParams) == 0 {
+		return &redacted
+	}
+
+	parts := strings.Split(u.RawQuery, "&")
+	for i, part := range parts {
+		rawName := part
+		if j := strings.Index(part, "="); j >= 0 {
+			rawName = part[:j]
+		}
+		name := rawName
+		if unescaped, err := url.QueryUnescape(rawName); err == nil {
+			name = unescaped
+		}
+		if matchAny(r.queryParams, name) {
+			parts[i] = rawName + "=" + RedactedValue
+		}
+	}
+	redacted.RawQuery = strings.Join(parts, "&")
+	return &redacted
+}
+
+// RedactJSON returns the JSON body with the values at the redacted paths replaced,
+// a body which is not valid JSON is returned as is
+func (r *Redactor) RedactJSON(body []byte) []byte {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.jsonPaths) == 0 {
+		return body
+	}
+
+	var v interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil || decoder.More() {
+		return body
+	}
+	for _, path := range r.jsonPaths {
+		v = redactJSONPath(v, path)
+	}
+	redacted, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+	return redacted
+}
+
+// RedactError returns the error with the url of a *url.Error or a *StatusError redacted
+// The message of an error wrapping them is redacted too, the wrapped errors are kept for errors.Is and errors.As
+func (r *Redactor) RedactError(err error) error {
+	switch e := err.(type) {
+	case *url.Error:
+		return &url.Error{Op: e.Op, URL: r.RedactURL(e.URL), Err: r.RedactError(e.Err)}
+	case *StatusError:
+		redacted := *e
+		redacted.URL = r.RedactURL(e.URL)
+		return &redacted
+	}
+
+	message := err.Error()
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		message = strings.ReplaceAll(message, urlErr.URL, r.RedactURL(urlErr.URL))
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		message = strings.ReplaceAll(message, statusErr.URL, r.RedactURL(statusErr.URL))
+	}
+	if message != err.Error() {
+		return &redactedError{message: message, err: err}
+	}
+	return err
+}
+
+// redactedError is an error with a redacted message
+type redactedError struct {
+	message string
+	err     error
+}
+
+// Error implements the error interface
+func (e *redactedError) Error() string {
+	return e.message
+}
+
+// Unwrap returns the original error
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// redactJSONPath replaces the values at the path in a decoded JSON value
+func redactJSONPath(v interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return RedactedValue
+	}
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if path[0] == "*" || path[0] == key {
+				value[key] = redactJSONPath(child, path[1:])
+			}
+		}
+	case []interface{}:
+		elementPath := path
+		if path[0] == "*" {
+			elementPath = path[1:]
+		}
+		for i, child := range value {
+			value[i] = redactJSONPath(child, elementPath)
+		}
+	}
+	return v
+}
+
+// matchAny checks whether one of the regexps matches the name
+func matchAny(regexps []*regexp.Regexp, name string) bool {
+	for _, re := range regexps {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redactor sets the redactor applied to the logs and dumps of the client
+func (g *GHttpClient) Redactor(redactor *Redactor) *GHttpClient {
+	g.redactor = redactor
+	return g
+}
+
+// getRedactor returns the redactor of the client, or DefaultRedactor
+func (g *GHttpClient) getRedactor() *Redactor {
+	if g.redactor != nil {
+		return g.redactor
+	}
+	return DefaultRedactor
+}
@@ -0,0 +1,240 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultRetryPolicy is the retry policy of clients created by NewClient
+// nil means a request is sent only once
+var DefaultRetryPolicy *RetryPolicy
+
+// RetryPolicy describes when and how a request is retried
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, the first one included
+	MaxAttempts int
+	// MinBackoff is the wait before the first retry, it doubles on each retry
+	MinBackoff time.Duration
+	// MaxBackoff caps the wait between two attempts, 0 means no cap
+	MaxBackoff time.Duration
+	// Jitter randomizes each wait by up to the given fraction, 0.2 means ±20%
+	Jitter float64
+	// StatusCodes are the response status codes which trigger a retry
+	StatusCodes []int
+	// NetworkErrors retries the request when the round trip returns an error
+	NetworkErrors bool
+	// RespectRetryAfter waits as long as the Retry-After response header asks, capped by MaxBackoff
+	RespectRetryAfter bool
+	// NonIdempotent allows retrying POST, PATCH and other non-idempotent methods
+	NonIdempotent bool
+	// OnAttempt is called after each attempt with the attempt number starting from 1,
+	// the response or error of the attempt, and the wait before the next attempt,
+	// wait is 0 when there is no next attempt
+	OnAttempt func(attempt int, response *http.Response, err error, wait time.Duration)
+}
+
+// NewRetryPolicy returns a RetryPolicy with 3 attempts, exponential backoff from 100ms to 10s,
+// 20% jitter, retrying on network errors and on 429, 502, 503, 504
+func NewRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 3,
+		MinBackoff:  100 * time.Millisecond,
+		MaxBackoff:  10 * time.Second,
+		Jitter:      0.2,
+		StatusCodes: []int{
+			http.StatusTooManyRequests,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+		NetworkErrors:     true,
+		RespectRetryAfter: true,
+	}
+}
+
+// Retry sets the retry policy, nil disables retrying
+func (g *GHttpClient) Retry(policy *RetryPolicy) *GHttpClient {
+	g.retryPolicy = policy
+	return g
+}
+
+// allows checks whether the policy may retry the request
+func (p *RetryPolicy) allows(request *http.Request) bool {
+	if p == nil || p.MaxAttempts <= 1 {
+		return false
+	}
+	if p.NonIdempotent {
+		return true
+	}
+	switch request.Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	// the same rule as net/http uses for its own retries
+	_, hasKey := request.Header["Idempotency-Key"]
+	_, hasXKey := request.Header["X-Idempotency-Key"]
+	return hasKey || hasXKey
+}
+
+// retries tells whether the request can be retried, a multipart body with a part which can not be replayed
+// is streamed once and never buffered, so it is not retried
+func (g *GHttpClient) retries(request *http.Request) bool {
+	if g.multipart != nil && !g.multipart.replayable() {
+		return false
+	}
+	return g.retryPolicy.allows(request)
+}
+
+// next tells whether another attempt should follow the given one, and how long to wait before it
+func (p *RetryPolicy) next(attempt int, request *http.Request, response *http.Response, err error) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+	if err != nil {
+		if !p.NetworkErrors || request.Context().Err() != nil || errors.Is(err, rateLimitDeadlineError{}) ||
+			errors.Is(err, ErrCircuitOpen) {
+			return 0, false
+		}
+		return p.backoff(attempt), true
+	}
+
+	retryable := false
+	for _, code := range p.StatusCodes {
+		if response.StatusCode == code {
+			retryable = true
+			break
+		}
+	}
+	if !retryable {
+		return 0, false
+	}
+
+	wait := p.backoff(attempt)
+	if p.RespectRetryAfter {
+		if retryAfter, ok := parseRetryAfter(response.Header.Get("Retry-After")); ok {
+			wait = retryAfter
+			if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+				wait = p.MaxBackoff
+			}
+		}
+	}
+	return wait, true
+}
+
+// backoff returns the exponential wait after the given attempt
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	wait := float64(p.MinBackoff) * math.Pow(2, float64(attempt-1))
+	if p.MaxBackoff > 0 && wait > float64(p.MaxBackoff) {
+		wait = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		wait = wait * (1 + p.Jitter*(2*rand.Float64()-1))
+	}
+	return time.Duration(wait)
+}
+
+// parseRetryAfter parses a Retry-After header in seconds or in http date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+// bufferBody makes the body of a request replayable, so that it can be sent again
+// A body implementing io.Seeker is replayed by seeking back to its start, and returned to be closed once
+// the request is sent, other bodies are read into memory
+func bufferBody(request *http.Request, body io.Reader) (io.Closer, error) {
+	if request.Body == nil || request.Body == http.NoBody || request.GetBody != nil {
+		return nil, nil
+	}
+	if seeker, ok := body.(io.ReadSeeker); ok {
+		if start, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			if end, err := seeker.Seek(0, io.SeekEnd); err == nil {
+				if _, err := seeker.Seek(start, io.SeekStart); err == nil {
+					request.ContentLength = end - start
+					request.GetBody = func() (io.ReadCloser, error) {
+						_, err := seeker.Seek(start, io.SeekStart)
+						return ioutil.NopCloser(seeker), err
+					}
+					request.Body = ioutil.NopCloser(seeker)
+					closer, _ := body.(io.Closer)
+					return closer, nil
+				}
+			}
+		}
+	}
+
+	content, err := ioutil.ReadAll(request.Body)
+	request.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	request.ContentLength = int64(len(content))
+	request.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(content)), nil
+	}
+	request.Body, _ = request.GetBody()
+	return nil, nil
+}
+
+// rewindRequest returns a copy of the request with a fresh body for another attempt
+func rewindRequest(request *http.Request) (*http.Request, error) {
+	rewound := request.Clone(request.Context())
+	if request.GetBody != nil {
+		body, err := request.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		rewound.Body = body
+	}
+	return rewound, nil
+}
+
+// discardResponse drains and closes the body of a response which will not be returned
+func discardResponse(response *http.Response) {
+	if response == nil || response.Body == nil {
+		return
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(response.Body, 4096))
+	response.Body.Close()
+}
+
+// sleepContext waits for the duration, it returns false if the context is done before
+func sleepContext(ctx context.Context, wait time.Duration) bool {
+	if wait <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient_test
+
+import (
+	"github.com/panwenbin/ghttpclient"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	policy := ghttpclient.NewRetryPolicy()
+	policy.MinBackoff = time.Millisecond
+	var attempts []int
+	policy.OnAttempt = func(attempt int, response *http.Response, err error, wait time.Duration) {
+		attempts = append(attempts, attempt)
+	}
+
+	body, err := ghttpclient.NewClient().Url(server.URL).Retry(policy).
+		Body(ioutil.NopCloser(strings.NewReader("ghttpclient"))).Put().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "ghttpclient" {
+		t.Errorf("expect ghttpclient, got %s", body)
+	}
+	if len(attempts) != 3 {
+		t.Errorf("expect 3 attempts, got %d", len(attempts))
+	}
+}
+
+func TestRetryNonIdempotent(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	policy := ghttpclient.NewRetryPolicy()
+	policy.MinBackoff = time.Millisecond
+	response, err := ghttpclient.NewClient().Url(server.URL).Retry(policy).Post().Response()
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if calls != 1 {
+		t.Errorf("expect 1 call, got %d", calls)
+	}
+
+	policy.NonIdempotent = true
+	calls = 0
+	response, err = ghttpclient.NewClient().Url(server.URL).Retry(policy).Post().Response()
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if calls != 3 {
+		t.Errorf("expect 3 calls, got %d", calls)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("ghttpclient"))
+	}))
+	defer server.Close()
+
+	policy := ghttpclient.NewRetryPolicy()
+	policy.MinBackoff = time.Millisecond
+	var waits []time.Duration
+	policy.OnAttempt = func(attempt int, response *http.Response, err error, wait time.Duration) {
+		waits = append(waits, wait)
+	}
+
+	_, err := ghttpclient.NewClient().Url(server.URL).Retry(policy).Get().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(waits) != 2 || waits[0] != time.Second {
+		t.Errorf("expect a wait of 1s, got %v", waits)
+	}
+}
+
+// countingFile counts the bytes read from a file
+type countingFile struct {
+	*os.File
+	read int
+}
+
+func (f *countingFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.read += n
+	return n, err
+}
+
+func TestRetrySeekableBody(t *testing.T) {
+	server := newFailingServer(t, failFirst(1), http.HandlerFunc(echo))
+	tmp, err := os.CreateTemp(t.TempDir(), "body")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp.WriteString("ghttpclient")
+	tmp.Seek(0, io.SeekStart)
+	file := &countingFile{File: tmp}
+
+	policy := ghttpclient.NewRetryPolicy()
+	policy.MinBackoff = time.Millisecond
+	body, err := ghttpclient.NewClient().Url(server.URL+"/request").Retry(policy).Body(file).
+		Dump(ioutil.Discard, nil).Put().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "||ghttpclient" {
+		t.Errorf("expect the file to be replayed, got %s", body)
+	}
+	if file.read != 4*len("ghttpclient") {
+		t.Errorf("expect the file to be read by the dump and once per attempt instead of buffered, got %d bytes read", file.read)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err == nil {
+		t.Error("expect the file to be closed once the request is sent")
+	}
+}
@@ -7,11 +7,8 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/panwenbin/ghttpclient/header"
-	"golang.org/x/net/html/charset"
-	"golang.org/x/text/transform"
 	"io"
 	"io/ioutil"
 	"log"
@@ -24,7 +21,9 @@ import (
 var Debug bool
 
 // GzipBody encodes the body with gzip
-func GzipBody(body io.Reader) *bytes.Buffer{
+// Deprecated: use GzipReader, which encodes the body while it is read and returns its read errors,
+// or CompressBody of a client, which also sets the Content-Encoding header
+func GzipBody(body io.Reader) *bytes.Buffer {
 	buf := &bytes.Buffer{}
 	gz, _ := gzip.NewWriterLevel(buf, gzip.DefaultCompression)
 	content, _ := ioutil.ReadAll(body)
@@ -38,136 +37,191 @@ func GzipBody(body io.Reader) *bytes.Buffer{
 	return buf
 }
 
+// GzipReader returns a reader of the body encoded with gzip while it is read, by a goroutine started by the first Read
+// A read error of the body is returned by the reader, closing the reader closes the body if it is an io.Closer
+func GzipReader(body io.Reader) io.ReadCloser {
+	closer, ok := body.(io.ReadCloser)
+	if !ok {
+		closer = ioutil.NopCloser(body)
+	}
+	gzipCompression := &compression{
+		coding: "gzip",
+		level:  gzip.DefaultCompression,
+		compressor: func(w io.Writer, level int) (io.WriteCloser, error) {
+			return gzip.NewWriterLevel(w, level)
+		},
+	}
+	return gzipCompression.compress(closer)
+}
+
 // Send a Request with GET method
 func Get(url string, httpHeader header.GHttpHeader) *GHttpClient {
-	httpHeader = httpHeader.RemoveContentEncoding()
-	return NewClient().Debug(Debug).Url(url).Headers(httpHeader).Get()
+	return get(NewClient(), url, httpHeader)
 }
 
 // Send a Request with POST method
 func Post(url string, body io.Reader, httpHeader header.GHttpHeader) *GHttpClient {
-	if httpHeader.IsContentEncodingZip() {
-		body = GzipBody(body)
-	}
-	return NewClient().Debug(Debug).Url(url).Headers(httpHeader).Body(body).Post()
+	return post(NewClient(), url, body, httpHeader)
 }
 
 // Send a Request as a json with POST Method
 func PostJson(url string, jsonBytes []byte, httpHeader header.GHttpHeader) *GHttpClient {
-	var body io.Reader
-	body = bytes.NewReader(jsonBytes)
-	if httpHeader.IsContentEncodingZip() {
-		body = GzipBody(body)
-	}
-	return NewClient().Debug(Debug).Url(url).Headers(httpHeader).Body(body).
-		ContentType(header.CONTENT_TYPE_JSON).Post()
+	return postJson(NewClient(), url, jsonBytes, httpHeader)
 }
 
 // Send a Request as a form with POST method
 func PostForm(url string, data url.Values, httpHeader header.GHttpHeader) *GHttpClient {
-	var body io.Reader
-	body = strings.NewReader(data.Encode())
-	if httpHeader.IsContentEncodingZip() {
-		body = GzipBody(body)
-	}
-	return NewClient().Debug(Debug).Url(url).Headers(httpHeader).Body(body).
-		ContentType(header.CONTENT_TYPE_FORM_URLENCODED).Post()
+	return postForm(NewClient(), url, data, httpHeader)
 }
 
 // Send a Request with PUT method
 func Put(url string, body io.Reader, httpHeader header.GHttpHeader) *GHttpClient {
-	if httpHeader.IsContentEncodingZip() {
-		body = GzipBody(body)
-	}
-	return NewClient().Debug(Debug).Url(url).Headers(httpHeader).Body(body).Put()
+	return put(NewClient(), url, body, httpHeader)
 }
 
 // Send a Request as a json with PUT method
 func PutJson(url string, jsonBytes []byte, httpHeader header.GHttpHeader) *GHttpClient {
-	var body io.Reader
-	body = bytes.NewReader(jsonBytes)
-	if httpHeader.IsContentEncodingZip() {
-		body = GzipBody(body)
-	}
-	return NewClient().Debug(Debug).Url(url).Headers(httpHeader).Body(body).
-		ContentType(header.CONTENT_TYPE_JSON).Put()
+	return putJson(NewClient(), url, jsonBytes, httpHeader)
 }
 
 // Send a Request with PATCH method
 func Patch(url string, body io.Reader, httpHeader header.GHttpHeader) *GHttpClient {
-	if httpHeader.IsContentEncodingZip() {
-		body = GzipBody(body)
-	}
-	return NewClient().Debug(Debug).Url(url).Headers(httpHeader).Body(body).Patch()
+	return patch(NewClient(), url, body, httpHeader)
 }
 
 // Send a Request with DELETE method
 func Delete(url string, httpHeader header.GHttpHeader) *GHttpClient {
-	httpHeader = httpHeader.RemoveContentEncoding()
-	return NewClient().Debug(Debug).Url(url).Headers(httpHeader).Delete()
+	return del(NewClient(), url, httpHeader)
 }
 
 // Send a Request with OPTIONS method
 func Options(url string, httpHeader header.GHttpHeader) *GHttpClient {
-	httpHeader = httpHeader.RemoveContentEncoding()
-	return NewClient().Debug(Debug).Url(url).Headers(httpHeader).Options()
+	return options(NewClient(), url, httpHeader)
 }
 
-// ReadBodyClose fetches the response Body, then close the Body
-// supports gzip content-type
-func ReadBodyClose(response *http.Response) ([]byte, error) {
-	if response == nil {
-		return nil, errors.New("response  is nil")
+// gzipBody sets the request body of the client, compressed with gzip in memory when httpHeader has the gzip
+// Content-Encoding header, so that it is sent with its Content-Length as the legacy helpers always did
+// An error reading the body is returned by the action of the client
+func gzipBody(g *GHttpClient, httpHeader header.GHttpHeader, body io.Reader) *GHttpClient {
+	if !httpHeader.IsContentEncodingZip() || body == nil {
+		return g.Body(body)
 	}
+	buf := &bytes.Buffer{}
+	gz, _ := gzip.NewWriterLevel(buf, gzip.DefaultCompression)
+	if _, err := io.Copy(gz, body); err != nil {
+		g.setOptionErr(err)
+	}
+	gz.Close()
+	return g.Body(buf)
+}
 
-	defer response.Body.Close()
+// get sends a Request with GET method by the client
+func get(g *GHttpClient, url string, httpHeader header.GHttpHeader) *GHttpClient {
+	httpHeader = httpHeader.RemoveContentEncoding()
+	return g.Url(url).Headers(httpHeader).Get()
+}
 
-	var body []byte
-	var err error
+// post sends a Request with POST method by the client
+func post(g *GHttpClient, url string, body io.Reader, httpHeader header.GHttpHeader) *GHttpClient {
+	return gzipBody(g.Url(url).Headers(httpHeader), httpHeader, body).Post()
+}
+
+// postJson sends a Request as a json with POST Method by the client
+func postJson(g *GHttpClient, url string, jsonBytes []byte, httpHeader header.GHttpHeader) *GHttpClient {
+	return gzipBody(g.Url(url).Headers(httpHeader), httpHeader, bytes.NewReader(jsonBytes)).
+		ContentType(header.CONTENT_TYPE_JSON).Post()
+}
+
+// postForm sends a Request as a form with POST method by the client
+func postForm(g *GHttpClient, url string, data url.Values, httpHeader header.GHttpHeader) *GHttpClient {
+	return gzipBody(g.Url(url).Headers(httpHeader), httpHeader, strings.NewReader(data.Encode())).
+		ContentType(header.CONTENT_TYPE_FORM_URLENCODED).Post()
+}
+
+// put sends a Request with PUT method by the client
+func put(g *GHttpClient, url string, body io.Reader, httpHeader header.GHttpHeader) *GHttpClient {
+	return gzipBody(g.Url(url).Headers(httpHeader), httpHeader, body).Put()
+}
+
+// putJson sends a Request as a json with PUT method by the client
+func putJson(g *GHttpClient, url string, jsonBytes []byte, httpHeader header.GHttpHeader) *GHttpClient {
+	return gzipBody(g.Url(url).Headers(httpHeader), httpHeader, bytes.NewReader(jsonBytes)).
+		ContentType(header.CONTENT_TYPE_JSON).Put()
+}
 
-	if response.Header.Get("Content-Encoding") == "gzip" {
-		gzReader, err := gzip.NewReader(response.Body)
-		if err != nil {
-			return nil, err
+// patch sends a Request with PATCH method by the client
+func patch(g *GHttpClient, url string, body io.Reader, httpHeader header.GHttpHeader) *GHttpClient {
+	return gzipBody(g.Url(url).Headers(httpHeader), httpHeader, body).Patch()
+}
+
+// del sends a Request with DELETE method by the client
+func del(g *GHttpClient, url string, httpHeader header.GHttpHeader) *GHttpClient {
+	httpHeader = httpHeader.RemoveContentEncoding()
+	return g.Url(url).Headers(httpHeader).Delete()
+}
+
+// options sends a Request with OPTIONS method by the client
+func options(g *GHttpClient, url string, httpHeader header.GHttpHeader) *GHttpClient {
+	httpHeader = httpHeader.RemoveContentEncoding()
+	return g.Url(url).Headers(httpHeader).Options()
+}
+
+// ReadBodyClose fetches the response Body, then close the Body
+// supports the content codings of the registered decompressors
+func ReadBodyClose(response *http.Response) ([]byte, error) {
+	return readBodyClose(response, 0)
+}
+
+// readBodyClose fetches the response Body decoded by the body pipeline, then close the Body
+func readBodyClose(response *http.Response, maxBodySize int64) ([]byte, error) {
+	body, err := decodeBody(response, maxBodySize)
+	if err != nil {
+		if response != nil {
+			response.Body.Close()
 		}
-		body, err = ioutil.ReadAll(gzReader)
-	} else {
-		body, err = ioutil.ReadAll(response.Body)
+		return nil, err
 	}
+	defer body.Close()
+
+	content, err := ioutil.ReadAll(body)
 	if err != nil {
 		return nil, err
 	}
 
-	return body, nil
+	return content, nil
 }
 
 // TryUTF8ReadBodyClose tries to transfer the body bytes to utf-8 bytes when the body bytes is not in utf-8 encoding
 func TryUTF8ReadBodyClose(response *http.Response) ([]byte, error) {
-	body, err := ReadBodyClose(response)
-	if err != nil {
-		return nil, err
-	}
-
-	e, name, _ := charset.DetermineEncoding(body, response.Header.Get("Content-Type"))
-	if name == "utf-8" {
-		return body, nil
-	}
+	return tryUTF8ReadBodyClose(response, 0)
+}
 
-	utf8Body, _, err := transform.Bytes(e.NewDecoder(), body)
+// tryUTF8ReadBodyClose is TryUTF8ReadBodyClose with a body size limit
+func tryUTF8ReadBodyClose(response *http.Response, maxBodySize int64) ([]byte, error) {
+	body, err := decodeBody(response, maxBodySize)
 	if err != nil {
-		return body, nil
+		if response != nil {
+			response.Body.Close()
+		}
+		return nil, err
 	}
+	defer body.Close()
 
-	return utf8Body, nil
+	return ioutil.ReadAll(toUTF8(body, response.Header.Get("Content-Type"), true))
 }
 
 // ReadJsonClose fetches the response Body and try to decode as a json, then close the Body
 func ReadJsonClose(response *http.Response, v interface{}) error {
-	contentType := response.Header.Get("Content-Type")
-	if strings.Index(contentType, header.CONTENT_TYPE_JSON) == -1 {
-		return errors.New(fmt.Sprintf("content type application/json expected, but %s got", contentType))
+	return readJsonClose(response, v, 0)
+}
+
+// readJsonClose is ReadJsonClose with a body size limit
+func readJsonClose(response *http.Response, v interface{}, maxBodySize int64) error {
+	if err := expectJson(response); err != nil {
+		response.Body.Close()
+		return err
 	}
-	body, err := ReadBodyClose(response)
+	body, err := readBodyClose(response, maxBodySize)
 	if err != nil {
 		return err
 	}
@@ -179,6 +233,15 @@ func ReadJsonClose(response *http.Response, v interface{}) error {
 	return nil
 }
 
+// expectJson checks that the response is a json
+func expectJson(response *http.Response) error {
+	contentType := response.Header.Get("Content-Type")
+	if strings.Index(contentType, header.CONTENT_TYPE_JSON) == -1 {
+		return fmt.Errorf("%w: application/json expected, but %s got", ErrContentTypeMismatch, contentType)
+	}
+	return nil
+}
+
 // init inits Debug on/off
 func init() {
 	debug := os.Getenv("DEBUG")
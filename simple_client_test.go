@@ -5,20 +5,127 @@ package ghttpclient_test
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"github.com/panwenbin/ghttpclient"
 	"github.com/panwenbin/ghttpclient/header"
 	"golang.org/x/text/encoding/simplifiedchinese"
 	"golang.org/x/text/transform"
+	"io"
+	"io/ioutil"
 	"math/rand"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
+// newEchoServer starts a server which answers with the request body,
+// or with the last segment of the path when the body is empty
+// Some paths have their own behaviors:
+//
+//	/ua           answers with the User-Agent
+//	/gbk          answers with the body as text/plain in gbk charset
+//	/redirect     redirects to /ghttpclient
+//	/slow         answers after 1 second
+//	/cookie/set   sets the cookie msg=ghttpclient
+//	/cookie/get   answers with the value of the cookie msg
+//	/request      answers with the Content-Type, the query and the body, separated by |
+//
+// A gzip request body is decoded, and the response is gzip encoded when the request accepts gzip
+func newEchoServer(t *testing.T) *httptest.Server {
+	return newFailingServer(t, nil, http.HandlerFunc(echo))
+}
+
+// echo is the handler of newEchoServer
+func echo(w http.ResponseWriter, r *http.Request) {
+	var reader io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gzReader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reader = gzReader
+	}
+	body, _ := ioutil.ReadAll(reader)
+
+	switch r.URL.Path {
+	case "/ua":
+		body = []byte(r.UserAgent())
+	case "/gbk":
+		w.Header().Set("Content-Type", "text/plain; charset=gbk")
+	case "/redirect":
+		http.Redirect(w, r, "/ghttpclient", http.StatusFound)
+		return
+	case "/slow":
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+			return
+		}
+	case "/cookie/set":
+		http.SetCookie(w, &http.Cookie{Name: "msg", Value: "ghttpclient", Path: "/"})
+	case "/cookie/get":
+		cookie, err := r.Cookie("msg")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = []byte(cookie.Value)
+	case "/request":
+		body = []byte(r.Header.Get("Content-Type") + "|" + r.URL.RawQuery + "|" + string(body))
+	default:
+		if contentType := r.Header.Get("Content-Type"); contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+	}
+	if len(body) == 0 {
+		body = []byte(path.Base(r.URL.Path))
+	}
+
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		w.Header().Set("Content-Encoding", "gzip")
+		gzWriter := gzip.NewWriter(w)
+		gzWriter.Write(body)
+		gzWriter.Close()
+		return
+	}
+	w.Write(body)
+}
+
+// newFailingServer starts a server answering 503 to the requests for which fail returns true, once their body is read,
+// the other requests are answered by handler
+func newFailingServer(t *testing.T, fail func() bool, handler http.Handler) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail != nil && fail() {
+			ioutil.ReadAll(r.Body)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// failFirst returns a fail function of newFailingServer failing the first n requests
+func failFirst(n int32) func() bool {
+	var calls int32
+	return func() bool {
+		return atomic.AddInt32(&calls, 1) <= n
+	}
+}
+
 func TestGet(t *testing.T) {
-	body, err := ghttpclient.Get("http://cp.fei.lv/ghttpclient", nil).ReadBodyClose()
+	server := newEchoServer(t)
+	body, err := ghttpclient.Get(server.URL+"/ghttpclient", nil).ReadBodyClose()
 	if err != nil {
 		t.Error("error occurs")
 		t.Fatal(err)
@@ -30,7 +137,8 @@ func TestGet(t *testing.T) {
 }
 
 func TestPost(t *testing.T) {
-	body, err := ghttpclient.Post("http://cp.fei.lv/", strings.NewReader("ghttpclient"), nil).ReadBodyClose()
+	server := newEchoServer(t)
+	body, err := ghttpclient.Post(server.URL+"/", strings.NewReader("ghttpclient"), nil).ReadBodyClose()
 	if err != nil {
 		t.Error("error occurs")
 		t.Fatal(err)
@@ -42,6 +150,7 @@ func TestPost(t *testing.T) {
 }
 
 func TestPostJson(t *testing.T) {
+	server := newEchoServer(t)
 	type TestJson struct {
 		Msg string `json:"msg"`
 	}
@@ -50,7 +159,7 @@ func TestPostJson(t *testing.T) {
 	}
 	jsonBytes, _ := json.Marshal(testJson)
 
-	bodyJsonBytes, err := ghttpclient.PostJson("http://cp.fei.lv/", jsonBytes, nil).ReadBodyClose()
+	bodyJsonBytes, err := ghttpclient.PostJson(server.URL+"/", jsonBytes, nil).ReadBodyClose()
 	if err != nil {
 		t.Error("error occurs")
 		t.Fatal(err)
@@ -62,10 +171,11 @@ func TestPostJson(t *testing.T) {
 }
 
 func TestPostForm(t *testing.T) {
+	server := newEchoServer(t)
 	data := url.Values{}
 	data.Add("msg", "ghttpclient")
 
-	body, err := ghttpclient.PostForm("http://cp.fei.lv/", data, nil).ReadBodyClose()
+	body, err := ghttpclient.PostForm(server.URL+"/", data, nil).ReadBodyClose()
 	if err != nil {
 		t.Error("error occurs")
 		t.Fatal(err)
@@ -77,7 +187,8 @@ func TestPostForm(t *testing.T) {
 }
 
 func TestPut(t *testing.T) {
-	body, err := ghttpclient.Put("http://cp.fei.lv/put", strings.NewReader("ghttpclient"), nil).ReadBodyClose()
+	server := newEchoServer(t)
+	body, err := ghttpclient.Put(server.URL+"/put", strings.NewReader("ghttpclient"), nil).ReadBodyClose()
 	if err != nil {
 		t.Error("error occurs")
 		t.Fatal(err)
@@ -89,6 +200,7 @@ func TestPut(t *testing.T) {
 }
 
 func TestPutJson(t *testing.T) {
+	server := newEchoServer(t)
 	type TestJson struct {
 		Msg string `json:"msg"`
 	}
@@ -98,7 +210,7 @@ func TestPutJson(t *testing.T) {
 	jsonBytes, _ := json.Marshal(testJson)
 
 	var bodyJson TestJson
-	err := ghttpclient.PutJson("http://cp.fei.lv/ghttpclient", jsonBytes, nil).ReadJsonClose(&bodyJson)
+	err := ghttpclient.PutJson(server.URL+"/ghttpclient", jsonBytes, nil).ReadJsonClose(&bodyJson)
 	if err != nil {
 		t.Error("error occurs")
 		t.Fatal(err)
@@ -111,7 +223,8 @@ func TestPutJson(t *testing.T) {
 }
 
 func TestPatch(t *testing.T) {
-	body, err := ghttpclient.Patch("http://cp.fei.lv/patch", strings.NewReader("ghttpclient"), nil).ReadBodyClose()
+	server := newEchoServer(t)
+	body, err := ghttpclient.Patch(server.URL+"/patch", strings.NewReader("ghttpclient"), nil).ReadBodyClose()
 	if err != nil {
 		t.Error("error occurs")
 		t.Fatal(err)
@@ -123,7 +236,8 @@ func TestPatch(t *testing.T) {
 }
 
 func TestDelete(t *testing.T) {
-	body, err := ghttpclient.Delete("http://cp.fei.lv/ghttpclient", nil).ReadBodyClose()
+	server := newEchoServer(t)
+	body, err := ghttpclient.Delete(server.URL+"/ghttpclient", nil).ReadBodyClose()
 	if err != nil {
 		t.Error("error occurs")
 		t.Fatal(err)
@@ -135,7 +249,8 @@ func TestDelete(t *testing.T) {
 }
 
 func TestOptions(t *testing.T) {
-	body, err := ghttpclient.Options("http://cp.fei.lv/ghttpclient", nil).ReadBodyClose()
+	server := newEchoServer(t)
+	body, err := ghttpclient.Options(server.URL+"/ghttpclient", nil).ReadBodyClose()
 	if err != nil {
 		t.Error("error occurs")
 		t.Fatal(err)
@@ -147,9 +262,10 @@ func TestOptions(t *testing.T) {
 }
 
 func TestGetWithHeader(t *testing.T) {
+	server := newEchoServer(t)
 	headers := header.GHttpHeader{}
 	headers.UserAgent("ghttpclient")
-	body, err := ghttpclient.Get("http://ua.fei.lv/", headers).ReadBodyClose()
+	body, err := ghttpclient.Get(server.URL+"/ua", headers).ReadBodyClose()
 
 	if err != nil {
 		t.Error("error occurs")
@@ -162,6 +278,7 @@ func TestGetWithHeader(t *testing.T) {
 }
 
 func TestGetWithGzip(t *testing.T) {
+	server := newEchoServer(t)
 	r := rand.New(rand.NewSource(time.Now().Unix()))
 	buffer := bytes.Buffer{}
 	for i := 0; i < 1024; i++ {
@@ -169,7 +286,17 @@ func TestGetWithGzip(t *testing.T) {
 	}
 	headers := header.GHttpHeader{}
 	headers.AcceptEncodingGzip()
-	body, err := ghttpclient.Post("http://cp.fei.lv/ghttpclient", bytes.NewReader(buffer.Bytes()), headers).ReadBodyClose()
+	client := ghttpclient.Post(server.URL+"/ghttpclient", bytes.NewReader(buffer.Bytes()), headers)
+	response, err := client.Response()
+	if err != nil {
+		t.Error("error occurs")
+		t.Fatal(err)
+	}
+	if response.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expect a gzip response, got %s", response.Header.Get("Content-Encoding"))
+	}
+
+	body, err := client.ReadBodyClose()
 	if err != nil {
 		t.Error("error occurs")
 		t.Fatal(err)
@@ -180,11 +307,118 @@ func TestGetWithGzip(t *testing.T) {
 	}
 }
 
+func TestPostWithGzipBody(t *testing.T) {
+	server := newEchoServer(t)
+	headers := header.GHttpHeader{}
+	headers.ContentEncodingZip()
+	body, err := ghttpclient.Post(server.URL+"/", strings.NewReader("ghttpclient"), headers).ReadBodyClose()
+	if err != nil {
+		t.Error("error occurs")
+		t.Fatal(err)
+	}
+
+	if strings.Compare("ghttpclient", string(body)) != 0 {
+		t.Fatalf("expect 'ghttpclient, got %s", body)
+	}
+}
+
+func TestLegacyHelpersGzipBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			http.Error(w, "expect a gzip body", http.StatusBadRequest)
+			return
+		}
+		if r.ContentLength < 0 {
+			http.Error(w, "expect a Content-Length", http.StatusLengthRequired)
+			return
+		}
+		gzReader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body, err := ioutil.ReadAll(gzReader)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	headers := header.GHttpHeader{}
+	headers.ContentEncodingZip()
+	clients := map[string]*ghttpclient.GHttpClient{
+		"Post":     ghttpclient.Post(server.URL, strings.NewReader("ghttpclient"), headers),
+		"PostJson": ghttpclient.PostJson(server.URL, []byte("ghttpclient"), headers),
+		"PostForm": ghttpclient.PostForm(server.URL, url.Values{"msg": {"ghttpclient"}}, headers),
+		"Put":      ghttpclient.Put(server.URL, strings.NewReader("ghttpclient"), headers),
+		"PutJson":  ghttpclient.PutJson(server.URL, []byte("ghttpclient"), headers),
+		"Patch":    ghttpclient.Patch(server.URL, strings.NewReader("ghttpclient"), headers),
+	}
+	for name, client := range clients {
+		body, err := client.ReadBodyClose()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !strings.Contains(string(body), "ghttpclient") {
+			t.Errorf("%s: expect a gzip body of ghttpclient, got %s", name, body)
+		}
+	}
+}
+
+func TestGzipBody(t *testing.T) {
+	gzReader, err := gzip.NewReader(ghttpclient.GzipBody(strings.NewReader("ghttpclient")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(gzReader)
+
+	if strings.Compare("ghttpclient", string(body)) != 0 {
+		t.Fatalf("expect 'ghttpclient, got %s", body)
+	}
+}
+
+func TestGzipReader(t *testing.T) {
+	reader := ghttpclient.GzipReader(strings.NewReader("ghttpclient"))
+	defer reader.Close()
+	gzReader, err := gzip.NewReader(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(gzReader)
+
+	if strings.Compare("ghttpclient", string(body)) != 0 {
+		t.Fatalf("expect 'ghttpclient, got %s", body)
+	}
+}
+
+func TestGzipReaderCloseUnread(t *testing.T) {
+	file, err := os.Open("simple_client.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ghttpclient.GzipReader(file).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Read(make([]byte, 1)); err == nil {
+		t.Error("expect the body closed with the unread reader")
+	}
+}
+
+func TestGzipReaderReadError(t *testing.T) {
+	_, err := ioutil.ReadAll(ghttpclient.GzipReader(io.MultiReader(strings.NewReader("ghttpclient"), failingReader{})))
+	if err == nil || !strings.Contains(err.Error(), "read failure") {
+		t.Errorf("expect the read failure, got %v", err)
+	}
+}
+
 func TestTryUTF8ReadBodyClose(t *testing.T) {
+	server := newEchoServer(t)
 	utf8Str := "简体中文"
 	gbkStr, _, _ := transform.String(simplifiedchinese.GBK.NewEncoder(), utf8Str)
 
-	body, err := ghttpclient.Post("http://cp.fei.lv/gbk", strings.NewReader(gbkStr), nil).TryUTF8ReadBodyClose()
+	body, err := ghttpclient.Post(server.URL+"/gbk", strings.NewReader(gbkStr), nil).TryUTF8ReadBodyClose()
 	if err != nil {
 		t.Error("error occurs")
 		t.Fatal(err)
@@ -194,3 +428,99 @@ func TestTryUTF8ReadBodyClose(t *testing.T) {
 		t.Fatalf("expect '%s', got %s", utf8Str, body)
 	}
 }
+
+func TestTryUTF8ReadBodyCloseSniff(t *testing.T) {
+	utf8Html := `<html><head><meta charset="gbk"></head><body>简体中文</body></html>`
+	gbkHtml, _, _ := transform.String(simplifiedchinese.GBK.NewEncoder(), utf8Html)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contentType := r.URL.Query().Get("type"); contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		} else {
+			// no Content-Type is sniffed by the server
+			w.Header()["Content-Type"] = nil
+		}
+		w.Write([]byte(gbkHtml))
+	}))
+	defer server.Close()
+
+	body, err := ghttpclient.NewClient().Url(server.URL).Get().TryUTF8ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != utf8Html {
+		t.Errorf("expect the body without Content-Type converted from its meta charset, got %s", body)
+	}
+
+	body, err = ghttpclient.NewClient().Url(server.URL + "?type=application/octet-stream").Get().TryUTF8ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != gbkHtml {
+		t.Errorf("expect the binary body untouched, got %s", body)
+	}
+}
+
+func TestNoRedirect(t *testing.T) {
+	server := newEchoServer(t)
+	body, err := ghttpclient.NewClient().Url(server.URL + "/redirect").Get().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Compare("ghttpclient", string(body)) != 0 {
+		t.Errorf("expect 'ghttpclient, got %s", body)
+	}
+
+	response, err := ghttpclient.NewClient().Url(server.URL + "/redirect").NoRedirect(true).Get().Response()
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusFound {
+		t.Errorf("expect %d, got %d", http.StatusFound, response.StatusCode)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	server := newEchoServer(t)
+	_, err := ghttpclient.NewClient().Url(server.URL + "/slow").Timeout(50 * time.Millisecond).Get().Response()
+	if err == nil {
+		t.Fatal("expect a timeout error")
+	}
+	if urlErr, ok := err.(*url.Error); !ok || !urlErr.Timeout() {
+		t.Errorf("expect a timeout error, got %s", err)
+	}
+}
+
+func TestProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("proxy " + r.URL.String()))
+	}))
+	defer proxy.Close()
+	proxyUrl, _ := url.Parse(proxy.URL)
+
+	body, err := ghttpclient.NewClient().Url("http://ghttpclient.test/ghttpclient").
+		Proxy(http.ProxyURL(proxyUrl)).Get().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Compare("proxy http://ghttpclient.test/ghttpclient", string(body)) != 0 {
+		t.Errorf("expect 'proxy http://ghttpclient.test/ghttpclient, got %s", body)
+	}
+}
+
+func TestCookieJar(t *testing.T) {
+	server := newEchoServer(t)
+	jar, _ := cookiejar.New(nil)
+
+	_, err := ghttpclient.NewClient().Url(server.URL + "/cookie/set").CookieJar(jar).Get().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ghttpclient.NewClient().Url(server.URL + "/cookie/get").CookieJar(jar).Get().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Compare("ghttpclient", string(body)) != 0 {
+		t.Errorf("expect 'ghttpclient, got %s", body)
+	}
+}
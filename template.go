@@ -0,0 +1,328 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient
+
+import (
+	"crypto/tls"
+	"github.com/panwenbin/ghttpclient/header"
+	"github.com/panwenbin/ghttpclient/metrics"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ClientTemplate holds the defaults shared by a group of requests
+// NewTemplate => set defaults => R() for each request => set attributes of the request => do the request
+// Attributes set on a request override the defaults of the template, headers are merged by key
+type ClientTemplate struct {
+	proto *GHttpClient
+}
+
+// NewTemplate returns a new ClientTemplate
+func NewTemplate() *ClientTemplate {
+	return &ClientTemplate{proto: NewClient()}
+}
+
+// R returns a new GHttpClient initialized with the defaults of the template
+func (t *ClientTemplate) R() *GHttpClient {
+	return t.proto.clone()
+}
+
+// BaseUrl sets the url which relative urls of requests are joined to
+func (t *ClientTemplate) BaseUrl(baseUrl string) *ClientTemplate {
+	t.proto.BaseUrl(baseUrl)
+	return t
+}
+
+// Header sets a default header
+func (t *ClientTemplate) Header(headerKey, headerValue string) *ClientTemplate {
+	t.proto.Header(headerKey, headerValue)
+	return t
+}
+
+// Headers sets a group of default headers
+func (t *ClientTemplate) Headers(httpHeader header.GHttpHeader) *ClientTemplate {
+	t.proto.Headers(httpHeader)
+	return t
+}
+
+// Query adds default query parameters, see GHttpClient.Query
+func (t *ClientTemplate) Query(v any) *ClientTemplate {
+	t.proto.Query(v)
+	return t
+}
+
+// UserAgent sets the default User-Agent header
+func (t *ClientTemplate) UserAgent(userAgent string) *ClientTemplate {
+	t.proto.UserAgent(userAgent)
+	return t
+}
+
+// CookieJar sets the default cookie jar
+func (t *ClientTemplate) CookieJar(cookieJar http.CookieJar) *ClientTemplate {
+	t.proto.CookieJar(cookieJar)
+	return t
+}
+
+// Proxy sets the default proxyFunc
+func (t *ClientTemplate) Proxy(proxyFunc func(req *http.Request) (*url.URL, error)) *ClientTemplate {
+	t.proto.Proxy(proxyFunc)
+	return t
+}
+
+// RoundTripper sets the default http.RoundTripper
+func (t *ClientTemplate) RoundTripper(roundTripper http.RoundTripper) *ClientTemplate {
+	t.proto.RoundTripper(roundTripper)
+	return t
+}
+
+// TLSConfig sets the default base tls.Config
+func (t *ClientTemplate) TLSConfig(config *tls.Config) *ClientTemplate {
+	t.proto.TLSConfig(config)
+	return t
+}
+
+// RootCAsFromFile adds the certificates in the PEM files to the default root CAs
+func (t *ClientTemplate) RootCAsFromFile(pemFiles ...string) *ClientTemplate {
+	t.proto.RootCAsFromFile(pemFiles...)
+	return t
+}
+
+// RootCAsFromPEM adds the certificates in PEM to the default root CAs
+func (t *ClientTemplate) RootCAsFromPEM(pemBytes []byte) *ClientTemplate {
+	t.proto.RootCAsFromPEM(pemBytes)
+	return t
+}
+
+// ClientCertificate adds a default client certificate from a pair of PEM files
+func (t *ClientTemplate) ClientCertificate(certFile, keyFile string) *ClientTemplate {
+	t.proto.ClientCertificate(certFile, keyFile)
+	return t
+}
+
+// ClientCertificateFromPEM adds a default client certificate from a pair of PEM blocks
+func (t *ClientTemplate) ClientCertificateFromPEM(certPEM, keyPEM []byte) *ClientTemplate {
+	t.proto.ClientCertificateFromPEM(certPEM, keyPEM)
+	return t
+}
+
+// ServerName sets the default server name used to verify the certificate of the server
+func (t *ClientTemplate) ServerName(serverName string) *ClientTemplate {
+	t.proto.ServerName(serverName)
+	return t
+}
+
+// MinTLSVersion sets the default minimum TLS version
+func (t *ClientTemplate) MinTLSVersion(version uint16) *ClientTemplate {
+	t.proto.MinTLSVersion(version)
+	return t
+}
+
+// CipherSuites sets the default cipher suites
+func (t *ClientTemplate) CipherSuites(cipherSuites ...uint16) *ClientTemplate {
+	t.proto.CipherSuites(cipherSuites...)
+	return t
+}
+
+// InsecureSkipVerify sets whether or not skipping ssl verify by default
+func (t *ClientTemplate) InsecureSkipVerify(skip bool) *ClientTemplate {
+	t.proto.InsecureSkipVerify(skip)
+	return t
+}
+
+// PinPublicKeys pins the public keys of the servers by default
+func (t *ClientTemplate) PinPublicKeys(sha256Pins ...string) *ClientTemplate {
+	t.proto.PinPublicKeys(sha256Pins...)
+	return t
+}
+
+// PinReportOnly sets whether a pinning mismatch is only logged by default
+func (t *ClientTemplate) PinReportOnly(reportOnly bool) *ClientTemplate {
+	t.proto.PinReportOnly(reportOnly)
+	return t
+}
+
+// NoRedirect sets whether or not to stop following redirects by default
+func (t *ClientTemplate) NoRedirect(noFollow bool) *ClientTemplate {
+	t.proto.NoRedirect(noFollow)
+	return t
+}
+
+// Timeout sets the default timeout
+func (t *ClientTemplate) Timeout(timeout time.Duration) *ClientTemplate {
+	t.proto.Timeout(timeout)
+	return t
+}
+
+// Debug sets the default debug
+func (t *ClientTemplate) Debug(debug bool) *ClientTemplate {
+	t.proto.Debug(debug)
+	return t
+}
+
+// Logger sets the default logger
+func (t *ClientTemplate) Logger(logger Logger) *ClientTemplate {
+	t.proto.Logger(logger)
+	return t
+}
+
+// Redactor sets the default redactor
+func (t *ClientTemplate) Redactor(redactor *Redactor) *ClientTemplate {
+	t.proto.Redactor(redactor)
+	return t
+}
+
+// Dump writes every request and its response to w by default
+func (t *ClientTemplate) Dump(w io.Writer, opts *DumpOptions) *ClientTemplate {
+	t.proto.Dump(w, opts)
+	return t
+}
+
+// Trace enables the tracing of the connection phases by default
+func (t *ClientTemplate) Trace() *ClientTemplate {
+	t.proto.Trace()
+	return t
+}
+
+// Metrics sets the default metrics collector and route template function
+func (t *ClientTemplate) Metrics(collector metrics.Collector, route metrics.RouteFunc) *ClientTemplate {
+	t.proto.Metrics(collector, route)
+	return t
+}
+
+// OnUploadProgress sets the default upload progress callback
+func (t *ClientTemplate) OnUploadProgress(progress func(sent, total int64)) *ClientTemplate {
+	t.proto.OnUploadProgress(progress)
+	return t
+}
+
+// OnDownloadProgress sets the default download progress callback
+func (t *ClientTemplate) OnDownloadProgress(progress func(received, total int64)) *ClientTemplate {
+	t.proto.OnDownloadProgress(progress)
+	return t
+}
+
+// ProgressInterval sets the default minimum interval between two calls of a progress callback
+func (t *ClientTemplate) ProgressInterval(interval time.Duration) *ClientTemplate {
+	t.proto.ProgressInterval(interval)
+	return t
+}
+
+// MaxBodySize sets the default limit of the decoded response body bytes
+func (t *ClientTemplate) MaxBodySize(n int64) *ClientTemplate {
+	t.proto.MaxBodySize(n)
+	return t
+}
+
+// Retry sets the default retry policy
+func (t *ClientTemplate) Retry(policy *RetryPolicy) *ClientTemplate {
+	t.proto.Retry(policy)
+	return t
+}
+
+// Use registers middlewares for every request of the template, they run before the middlewares of a request
+func (t *ClientTemplate) Use(middleware ...Middleware) *ClientTemplate {
+	t.proto.Use(middleware...)
+	return t
+}
+
+// ErrorOnStatus makes a response with a 4xx or 5xx status code an error by default
+func (t *ClientTemplate) ErrorOnStatus() *ClientTemplate {
+	t.proto.ErrorOnStatus()
+	return t
+}
+
+// ExpectStatus makes a response with a status code out of codes an error by default
+func (t *ClientTemplate) ExpectStatus(codes ...int) *ClientTemplate {
+	t.proto.ExpectStatus(codes...)
+	return t
+}
+
+// Send a Request with GET method
+func (t *ClientTemplate) Get(url string, httpHeader header.GHttpHeader) *GHttpClient {
+	return get(t.R(), url, httpHeader)
+}
+
+// Send a Request with POST method
+func (t *ClientTemplate) Post(url string, body io.Reader, httpHeader header.GHttpHeader) *GHttpClient {
+	return post(t.R(), url, body, httpHeader)
+}
+
+// Send a Request as a json with POST Method
+func (t *ClientTemplate) PostJson(url string, jsonBytes []byte, httpHeader header.GHttpHeader) *GHttpClient {
+	return postJson(t.R(), url, jsonBytes, httpHeader)
+}
+
+// Send a Request as a form with POST method
+func (t *ClientTemplate) PostForm(url string, data url.Values, httpHeader header.GHttpHeader) *GHttpClient {
+	return postForm(t.R(), url, data, httpHeader)
+}
+
+// Send a Request with PUT method
+func (t *ClientTemplate) Put(url string, body io.Reader, httpHeader header.GHttpHeader) *GHttpClient {
+	return put(t.R(), url, body, httpHeader)
+}
+
+// Send a Request as a json with PUT method
+func (t *ClientTemplate) PutJson(url string, jsonBytes []byte, httpHeader header.GHttpHeader) *GHttpClient {
+	return putJson(t.R(), url, jsonBytes, httpHeader)
+}
+
+// Send a Request with PATCH method
+func (t *ClientTemplate) Patch(url string, body io.Reader, httpHeader header.GHttpHeader) *GHttpClient {
+	return patch(t.R(), url, body, httpHeader)
+}
+
+// Send a Request with DELETE method
+func (t *ClientTemplate) Delete(url string, httpHeader header.GHttpHeader) *GHttpClient {
+	return del(t.R(), url, httpHeader)
+}
+
+// Send a Request with OPTIONS method
+func (t *ClientTemplate) Options(url string, httpHeader header.GHttpHeader) *GHttpClient {
+	return options(t.R(), url, httpHeader)
+}
+
+// AcceptEncoding sets the Accept-Encoding header of the template to the registered content codings
+func (t *ClientTemplate) AcceptEncoding() *ClientTemplate {
+	t.proto.AcceptEncoding()
+	return t
+}
+
+// NoAcceptEncoding sets whether to leave the Accept-Encoding header to the transport by default
+func (t *ClientTemplate) NoAcceptEncoding(disable bool) *ClientTemplate {
+	t.proto.NoAcceptEncoding(disable)
+	return t
+}
+
+// CompressBody sets the default compression of the request bodies
+func (t *ClientTemplate) CompressBody(coding string, level int) *ClientTemplate {
+	t.proto.CompressBody(coding, level)
+	return t
+}
+
+// CompressMinSize sets the default body size below which the request bodies are sent as is
+func (t *ClientTemplate) CompressMinSize(n int64) *ClientTemplate {
+	t.proto.CompressMinSize(n)
+	return t
+}
+
+// Cache sets the cache of the responses of the clients
+func (t *ClientTemplate) Cache(cache *Cache) *ClientTemplate {
+	t.proto.Cache(cache)
+	return t
+}
+
+// RateLimit limits the rate of the requests of all the clients of the template together
+func (t *ClientTemplate) RateLimit(limiter RequestLimiter) *ClientTemplate {
+	t.proto.RateLimit(limiter)
+	return t
+}
+
+// CircuitBreaker fails the requests of all the clients of the template fast while their circuit is open
+func (t *ClientTemplate) CircuitBreaker(breaker *CircuitBreaker) *ClientTemplate {
+	t.proto.CircuitBreaker(breaker)
+	return t
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient_test
+
+import (
+	"github.com/panwenbin/ghttpclient"
+	"github.com/panwenbin/ghttpclient/header"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientTemplate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Path", r.URL.Path)
+		w.Header().Set("X-Team", r.Header.Get("X-Team"))
+		w.Write([]byte(r.UserAgent()))
+	}))
+	defer server.Close()
+
+	template := ghttpclient.NewTemplate().
+		BaseUrl(server.URL+"/api/").
+		UserAgent("template").
+		Header("X-Team", "core")
+
+	client := template.R().Url("/users").UserAgent("request").Get()
+	response, err := client.Response()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path := response.Header.Get("X-Path"); path != "/api/users" {
+		t.Errorf("expect /api/users, got %s", path)
+	}
+	if team := response.Header.Get("X-Team"); team != "core" {
+		t.Errorf("expect core, got %s", team)
+	}
+	body, _ := client.ReadBodyClose()
+	if string(body) != "request" {
+		t.Errorf("expect request, got %s", body)
+	}
+
+	body, err = template.Get("users", header.GHttpHeader{}).ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "template" {
+		t.Errorf("expect template, got %s", body)
+	}
+}
+
+func TestClientTemplateUrlInQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.RequestURI()))
+	}))
+	defer server.Close()
+
+	template := ghttpclient.NewTemplate().BaseUrl(server.URL + "/api/")
+	body, err := template.R().Url("/login?next=https://example.com/x").Get().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "/api/login?next=https://example.com/x" {
+		t.Errorf("expect the relative url joined to the base url, got %s", body)
+	}
+}
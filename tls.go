@@ -0,0 +1,371 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLSTransportCacheSize is the number of transports kept for the clients with TLS attributes,
+// the idle connections of the least recently used transport are closed when it is evicted
+// A lowered size is applied by the next request of a client with TLS attributes
+var TLSTransportCacheSize = 64
+
+var (
+	tlsTransportsMu sync.Mutex
+	tlsTransportLRU = list.New()
+	tlsTransports   = make(map[string]*list.Element)
+)
+
+// tlsTransport is a cached transport with its key
+type tlsTransport struct {
+	key       string
+	transport *http.Transport
+}
+
+// tlsOptions are the TLS attributes of a client
+// a client with tlsOptions uses a clone of Transport, which is shared by the clients with the same options
+type tlsOptions struct {
+	config             *tls.Config
+	rootCAs            [][]byte
+	certificates       []tls.Certificate
+	serverName         string
+	minVersion         uint16
+	cipherSuites       []uint16
+	insecureSkipVerify bool
+	pins               []string
+	pinReportOnly      bool
+}
+
+// tlsOpts returns the TLS attributes of the client, creates them if needed
+func (g *GHttpClient) tlsOpts() *tlsOptions {
+	if g.tls == nil {
+		g.tls = &tlsOptions{}
+	}
+	return g.tls
+}
+
+// TLSConfig sets the base tls.Config of the client, other TLS attributes are applied on a copy of it
+// The config is identified by its pointer: the clients given the same *tls.Config share a cached transport
+// and its connections, while equal configs built separately get a transport each, which fills the cache
+// of TLSTransportCacheSize transports and closes the idle connections of the evicted ones,
+// so build the config once and reuse it. It is copied on first use and must not be modified afterwards
+func (g *GHttpClient) TLSConfig(config *tls.Config) *GHttpClient {
+	g.tlsOpts().config = config
+	return g
+}
+
+// RootCAsFromFile adds the certificates in the PEM files to the root CAs of the client,
+// the system root CAs are no longer used once a root CA is added
+func (g *GHttpClient) RootCAsFromFile(pemFiles ...string) *GHttpClient {
+	for _, pemFile := range pemFiles {
+		pemBytes, err := ioutil.ReadFile(pemFile)
+		if err != nil {
+			g.setOptionErr(err)
+			return g
+		}
+		g.RootCAsFromPEM(pemBytes)
+	}
+	return g
+}
+
+// RootCAsFromPEM adds the certificates in PEM to the root CAs of the client,
+// the system root CAs are no longer used once a root CA is added
+func (g *GHttpClient) RootCAsFromPEM(pemBytes []byte) *GHttpClient {
+	if !x509.NewCertPool().AppendCertsFromPEM(pemBytes) {
+		g.setOptionErr(errors.New("no certificate found in root CAs PEM"))
+		return g
+	}
+	g.tlsOpts().rootCAs = append(g.tlsOpts().rootCAs, pemBytes)
+	return g
+}
+
+// ClientCertificate adds a client certificate for mutual TLS from a pair of PEM files
+func (g *GHttpClient) ClientCertificate(certFile, keyFile string) *GHttpClient {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		g.setOptionErr(err)
+		return g
+	}
+	g.tlsOpts().certificates = append(g.tlsOpts().certificates, certificate)
+	return g
+}
+
+// ClientCertificateFromPEM adds a client certificate for mutual TLS from a pair of PEM blocks
+func (g *GHttpClient) ClientCertificateFromPEM(certPEM, keyPEM []byte) *GHttpClient {
+	certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		g.setOptionErr(err)
+		return g
+	}
+	g.tlsOpts().certificates = append(g.tlsOpts().certificates, certificate)
+	return g
+}
+
+// ServerName overrides the server name used to verify the certificate of the server
+func (g *GHttpClient) ServerName(serverName string) *GHttpClient {
+	g.tlsOpts().serverName = serverName
+	return g
+}
+
+// MinTLSVersion sets the minimum TLS version, such as tls.VersionTLS12
+func (g *GHttpClient) MinTLSVersion(version uint16) *GHttpClient {
+	g.tlsOpts().minVersion = version
+	return g
+}
+
+// CipherSuites sets the enabled cipher suites for TLS 1.2 and below
+func (g *GHttpClient) CipherSuites(cipherSuites ...uint16) *GHttpClient {
+	g.tlsOpts().cipherSuites = cipherSuites
+	return g
+}
+
+// InsecureSkipVerify sets whether or not skipping ssl verify for the client
+func (g *GHttpClient) InsecureSkipVerify(skip bool) *GHttpClient {
+	g.tlsOpts().insecureSkipVerify = skip
+	return g
+}
+
+// clone returns a deep copy of the options
+func (o *tlsOptions) clone() *tlsOptions {
+	if o == nil {
+		return nil
+	}
+	c := *o
+	c.rootCAs = append([][]byte(nil), o.rootCAs...)
+	c.certificates = append([]tls.Certificate(nil), o.certificates...)
+	c.cipherSuites = append([]uint16(nil), o.cipherSuites...)
+	c.pins = append([]string(nil), o.pins...)
+	return &c
+}
+
+// key identifies the options together with the base transport, and the base tls.Config by its pointer, see TLSConfig
+func (o *tlsOptions) key(base *http.Transport) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%p|%p|%s|%d|%v|%t|", base, o.config, o.serverName, o.minVersion, o.cipherSuites, o.insecureSkipVerify)
+	if len(o.pins) > 0 {
+		fmt.Fprintf(h, "%v|%t|", o.pins, o.pinReportOnly)
+	}
+	for _, pemBytes := range o.rootCAs {
+		fmt.Fprintf(h, "ca:%x|", sha256.Sum256(pemBytes))
+	}
+	for _, certificate := range o.certificates {
+		for _, der := range certificate.Certificate {
+			fmt.Fprintf(h, "cert:%x|", sha256.Sum256(der))
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// tlsConfig builds the tls.Config of the options on top of the TLS config of the base transport
+func (o *tlsOptions) tlsConfig(base *http.Transport) *tls.Config {
+	var config *tls.Config
+	if o.config != nil {
+		config = o.config.Clone()
+	} else if base.TLSClientConfig != nil {
+		config = base.TLSClientConfig.Clone()
+	} else {
+		config = &tls.Config{}
+	}
+
+	if len(o.rootCAs) > 0 {
+		config.RootCAs = x509.NewCertPool()
+		for _, pemBytes := range o.rootCAs {
+			config.RootCAs.AppendCertsFromPEM(pemBytes)
+		}
+	}
+	if len(o.certificates) > 0 {
+		config.Certificates = append(config.Certificates, o.certificates...)
+	}
+	if o.serverName != "" {
+		config.ServerName = o.serverName
+	}
+	if o.minVersion != 0 {
+		config.MinVersion = o.minVersion
+	}
+	if len(o.cipherSuites) > 0 {
+		config.CipherSuites = o.cipherSuites
+	}
+	if o.insecureSkipVerify {
+		config.InsecureSkipVerify = true
+	}
+	if len(o.pins) > 0 && !o.pinReportOnly {
+		pinned := o.clone()
+		verifyConnection := config.VerifyConnection
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			if verifyConnection != nil {
+				if err := verifyConnection(state); err != nil {
+					return err
+				}
+			}
+			// the host of a connection without server name is filled from the request by fillPinningHost
+			return pinned.verifyPins(state, "")
+		}
+	}
+	return config
+}
+
+// transport returns the cached clone of the base transport for the options
+func (o *tlsOptions) transport(base *http.Transport) *http.Transport {
+	key := o.key(base)
+
+	tlsTransportsMu.Lock()
+	defer tlsTransportsMu.Unlock()
+	// the cache is trimmed on every use, so that a lowered TLSTransportCacheSize applies at once
+	defer trimTLSTransports()
+	if element, ok := tlsTransports[key]; ok {
+		tlsTransportLRU.MoveToFront(element)
+		return element.Value.(*tlsTransport).transport
+	}
+	transport := base.Clone()
+	transport.TLSClientConfig = o.tlsConfig(base)
+	tlsTransports[key] = tlsTransportLRU.PushFront(&tlsTransport{key: key, transport: transport})
+	return transport
+}
+
+// trimTLSTransports evicts the least recently used transports beyond TLSTransportCacheSize, the lock must be held
+func trimTLSTransports() {
+	for TLSTransportCacheSize > 0 && tlsTransportLRU.Len() > TLSTransportCacheSize {
+		evicted := tlsTransportLRU.Remove(tlsTransportLRU.Back()).(*tlsTransport)
+		delete(tlsTransports, evicted.key)
+		evicted.transport.CloseIdleConnections()
+	}
+}
+
+// resetTLSTransports drops the cached transports, which are cloned from an outdated Transport
+func resetTLSTransports() {
+	tlsTransportsMu.Lock()
+	defer tlsTransportsMu.Unlock()
+	for element := tlsTransportLRU.Front(); element != nil; element = element.Next() {
+		element.Value.(*tlsTransport).transport.CloseIdleConnections()
+	}
+	tlsTransportLRU.Init()
+	tlsTransports = make(map[string]*list.Element)
+}
+
+// PinningError is returned when no public key of the server certificate chain matches the pinned ones
+type PinningError struct {
+	Host string
+	// Observed are the pins of the certificate chain presented by the server
+	Observed []string
+}
+
+// Error implements the error interface
+func (e *PinningError) Error() string {
+	return fmt.Sprintf("public key pinning failed for %s, observed pins: %s", e.Host, strings.Join(e.Observed, ", "))
+}
+
+// PinPublicKeys pins the public keys of the server, a connection is accepted only if a certificate
+// of the chain has one of the pins, so backup pins can be given along with the current one
+// A pin is the base64 encoded SHA-256 digest of a SubjectPublicKeyInfo, with or without a "sha256/" prefix
+func (g *GHttpClient) PinPublicKeys(sha256Pins ...string) *GHttpClient {
+	for _, pin := range sha256Pins {
+		pin = strings.TrimPrefix(pin, "sha256/")
+		if digest, err := base64.StdEncoding.DecodeString(pin); err != nil || len(digest) != sha256.Size {
+			g.setOptionErr(fmt.Errorf("invalid sha256 pin %s", pin))
+			return g
+		}
+		g.tlsOpts().pins = append(g.tlsOpts().pins, pin)
+	}
+	return g
+}
+
+// PinReportOnly sets whether a pinning mismatch is only logged by the client logger instead of failing
+func (g *GHttpClient) PinReportOnly(reportOnly bool) *GHttpClient {
+	g.tlsOpts().pinReportOnly = reportOnly
+	return g
+}
+
+// PublicKeyPin returns the pin of the public key of a certificate, as used by PinPublicKeys
+func PublicKeyPin(certificate *x509.Certificate) string {
+	digest := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
+
+// reportPins returns the request with a context logging the pinning mismatches of its new connections
+// to the logger of the client, or DefaultLogger
+func (g *GHttpClient) reportPins(request *http.Request) *http.Request {
+	pinned := g.tls.clone()
+	var host string
+	trace := &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			host, _, _ = net.SplitHostPort(hostPort)
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err != nil {
+				return
+			}
+			if err := pinned.verifyPins(state, host); err != nil {
+				logger := g.logger
+				if logger == nil {
+					logger = DefaultLogger
+				}
+				redactor := g.getRedactor()
+				logger.Log(Event{
+					Kind:   EventError,
+					Time:   time.Now(),
+					Method: request.Method,
+					URL:    redactor.redactURL(request.URL).String(),
+					Err:    redactor.RedactError(err),
+				})
+			}
+		},
+	}
+	return request.WithContext(httptrace.WithClientTrace(request.Context(), trace))
+}
+
+// fillPinningHost sets the host of a *PinningError of a connection without server name, such as to an IP address,
+// from the url of the failed request
+func fillPinningHost(err error) {
+	var pinningError *PinningError
+	var urlError *url.Error
+	if !errors.As(err, &pinningError) || pinningError.Host != "" || !errors.As(err, &urlError) {
+		return
+	}
+	if u, parseErr := url.Parse(urlError.URL); parseErr == nil {
+		pinningError.Host = u.Hostname()
+	}
+}
+
+// verifyPins checks the certificate chain of a connection against the pins,
+// host is the host of the error when the connection has no server name
+func (o *tlsOptions) verifyPins(state tls.ConnectionState, host string) error {
+	certificates := state.PeerCertificates
+	if len(state.VerifiedChains) > 0 {
+		certificates = nil
+		for _, chain := range state.VerifiedChains {
+			certificates = append(certificates, chain...)
+		}
+	}
+
+	observed := make([]string, 0, len(certificates))
+	for _, certificate := range certificates {
+		pin := PublicKeyPin(certificate)
+		for _, expected := range o.pins {
+			if pin == expected {
+				return nil
+			}
+		}
+		observed = append(observed, pin)
+	}
+
+	if state.ServerName != "" {
+		host = state.ServerName
+	}
+	return &PinningError{Host: host, Observed: observed}
+}
@@ -0,0 +1,246 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"github.com/panwenbin/ghttpclient"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTLSServer starts a TLS server which answers with the common name of the client certificate,
+// and returns it with its certificate in PEM
+func newTLSServer(t *testing.T, clientAuth tls.ClientAuthType) (*httptest.Server, []byte) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) > 0 {
+			w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+			return
+		}
+		w.Write([]byte("ghttpclient"))
+	}))
+	server.TLS = &tls.Config{ClientAuth: clientAuth}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	return server, certPEM
+}
+
+// newClientCertificate generates a self-signed client certificate and key in PEM
+func newClientCertificate(t *testing.T, commonName string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+// newServerCertificate generates a self-signed server certificate for 127.0.0.1, and returns it with its certificate in PEM
+func newServerCertificate(t *testing.T) (tls.Certificate, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ghttpclient"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key},
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestRootCAsFromPEM(t *testing.T) {
+	server, certPEM := newTLSServer(t, tls.NoClientCert)
+
+	_, err := ghttpclient.NewClient().Url(server.URL).Get().Response()
+	var unknownAuthority x509.UnknownAuthorityError
+	if !errors.As(err, &unknownAuthority) {
+		t.Fatalf("expect an unknown authority error, got %v", err)
+	}
+
+	body, err := ghttpclient.NewClient().Url(server.URL).RootCAsFromPEM(certPEM).
+		MinTLSVersion(tls.VersionTLS12).Get().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "ghttpclient" {
+		t.Errorf("expect ghttpclient, got %s", body)
+	}
+
+	_, err = ghttpclient.NewClient().Url(server.URL).RootCAsFromPEM([]byte("ghttpclient")).Get().Response()
+	if err == nil {
+		t.Error("expect an error for an invalid PEM")
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	server, certPEM := newTLSServer(t, tls.RequireAnyClientCert)
+	clientCertPEM, clientKeyPEM := newClientCertificate(t, "ghttpclient-client")
+
+	_, err := ghttpclient.NewClient().Url(server.URL).RootCAsFromPEM(certPEM).Get().ReadBodyClose()
+	if err == nil {
+		t.Fatal("expect an error without client certificate")
+	}
+
+	body, err := ghttpclient.NewTemplate().RootCAsFromPEM(certPEM).ClientCertificateFromPEM(clientCertPEM, clientKeyPEM).
+		R().Url(server.URL).Get().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "ghttpclient-client" {
+		t.Errorf("expect ghttpclient-client, got %s", body)
+	}
+}
+
+func TestInsecureSkipVerify(t *testing.T) {
+	server, _ := newTLSServer(t, tls.NoClientCert)
+
+	_, err := ghttpclient.NewClient().Url(server.URL).InsecureSkipVerify(true).Get().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ghttpclient.NewClient().Url(server.URL).Get().ReadBodyClose()
+	if err == nil {
+		t.Error("expect InsecureSkipVerify not to affect other clients")
+	}
+}
+
+func TestPinPublicKeys(t *testing.T) {
+	server, certPEM := newTLSServer(t, tls.NoClientCert)
+	pin := ghttpclient.PublicKeyPin(server.Certificate())
+	backupPin := "sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+
+	body, err := ghttpclient.NewClient().Url(server.URL).RootCAsFromPEM(certPEM).
+		PinPublicKeys(backupPin, pin).Get().ReadBodyClose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "ghttpclient" {
+		t.Errorf("expect ghttpclient, got %s", body)
+	}
+
+	_, err = ghttpclient.NewClient().Url(server.URL).RootCAsFromPEM(certPEM).ServerName("example.com").
+		PinPublicKeys(backupPin).Get().Response()
+	var pinningError *ghttpclient.PinningError
+	if !errors.As(err, &pinningError) {
+		t.Fatalf("expect a PinningError, got %v", err)
+	}
+	if pinningError.Host != "example.com" || len(pinningError.Observed) != 1 || pinningError.Observed[0] != pin {
+		t.Errorf("expect example.com with %s observed, got %s with %v", pin, pinningError.Host, pinningError.Observed)
+	}
+
+	_, err = ghttpclient.NewClient().Url(server.URL).RootCAsFromPEM(certPEM).
+		PinPublicKeys(backupPin).Get().Response()
+	if !errors.As(err, &pinningError) || pinningError.Host != "127.0.0.1" {
+		t.Errorf("expect a PinningError for 127.0.0.1 without server name, got %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		var reported []ghttpclient.Event
+		logger := ghttpclient.LoggerFunc(func(event ghttpclient.Event) {
+			if errors.As(event.Err, &pinningError) {
+				reported = append(reported, event)
+			}
+		})
+		_, err = ghttpclient.NewClient().Url(server.URL).RootCAsFromPEM(certPEM).
+			PinPublicKeys(backupPin).PinReportOnly(true).Logger(logger).Get().ReadBodyClose()
+		if err != nil {
+			t.Errorf("expect no error in report only mode, got %s", err)
+		}
+		if len(reported) != 1 {
+			t.Errorf("expect the mismatch to be reported to the logger of client %d, got %d reports", i, len(reported))
+		} else if reported[0].Method != "GET" || reported[0].URL != server.URL || pinningError.Host != "127.0.0.1" {
+			t.Errorf("expect the request and the host of the mismatch reported, got %s %s for %s",
+				reported[0].Method, reported[0].URL, pinningError.Host)
+		}
+		server.CloseClientConnections()
+	}
+}
+
+func TestTLSTransportCacheEviction(t *testing.T) {
+	var closed int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ghttpclient"))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			atomic.AddInt32(&closed, 1)
+		}
+	}
+	// a certificate of its own keeps the transports of the test out of the cache entries of other tests
+	certificate, certPEM := newServerCertificate(t)
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{certificate}}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	cacheSize := ghttpclient.TLSTransportCacheSize
+	ghttpclient.TLSTransportCacheSize = 1
+	t.Cleanup(func() {
+		ghttpclient.TLSTransportCacheSize = cacheSize
+	})
+
+	for _, version := range []uint16{tls.VersionTLS12, tls.VersionTLS13} {
+		_, err := ghttpclient.NewClient().Url(server.URL).RootCAsFromPEM(certPEM).MinTLSVersion(version).Get().ReadBodyClose()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&closed) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&closed) != 1 {
+		t.Errorf("expect the idle connection of the evicted transport to be closed, got %d closed", atomic.LoadInt32(&closed))
+	}
+}
+
+func TestTLSOptionsWithRoundTripper(t *testing.T) {
+	server, certPEM := newTLSServer(t, tls.NoClientCert)
+	transport := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+
+	_, err := ghttpclient.NewClient().Url(server.URL).RoundTripper(transport).RootCAsFromPEM(certPEM).
+		PinPublicKeys("sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=").Get().Response()
+	if err == nil || !strings.Contains(err.Error(), "RoundTripper") {
+		t.Errorf("expect the TLS options to be refused with a RoundTripper, got %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings are the durations of the connection phases of a request, see Trace
+// When a request is retried, they are the timings of the last attempt
+type Timings struct {
+	DNSLookup    time.Duration
+	TCPConnect   time.Duration
+	TLSHandshake time.Duration
+	// TimeToFirstByte is the time from the start of the attempt to the first response byte
+	TimeToFirstByte time.Duration
+	// BodyTransfer is the time from the first response byte to the end of the body, 0 until the body is read
+	BodyTransfer time.Duration
+	// Total is the time from the start of the attempt to the end of the body, or to the response until the body is read
+	Total      time.Duration
+	ConnReused bool
+	RemoteAddr string
+}
+
+// Trace enables the tracing of the connection phases of the requests, see Timings
+func (g *GHttpClient) Trace() *GHttpClient {
+	g.tracer = &tracer{}
+	return g
+}
+
+// Timings returns the timings of the last request, nil if Trace is not enabled
+func (g *GHttpClient) Timings() *Timings {
+	if g.tracer == nil {
+		return nil
+	}
+	return g.tracer.timings()
+}
+
+// tracer records the times of the connection phases
+type tracer struct {
+	mu    sync.Mutex
+	times traceTimes
+}
+
+// traceTimes are the times recorded by a tracer
+type traceTimes struct {
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	firstByte    time.Time
+	responded    time.Time
+	bodyDone     time.Time
+	reused       bool
+	remoteAddr   string
+}
+
+// attach resets the tracer, then returns the request with a context tracing the attempt
+func (t *tracer) attach(request *http.Request) *http.Request {
+	t.mu.Lock()
+	t.times = traceTimes{start: time.Now()}
+	t.mu.Unlock()
+
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.record(&t.times.dnsStart)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.record(&t.times.dnsDone)
+		},
+		ConnectStart: func(string, string) {
+			t.record(&t.times.connectStart)
+		},
+		ConnectDone: func(string, string, error) {
+			t.record(&t.times.connectDone)
+		},
+		TLSHandshakeStart: func() {
+			t.record(&t.times.tlsStart)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.record(&t.times.tlsDone)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.times.reused = info.Reused
+			if info.Conn != nil {
+				t.times.remoteAddr = info.Conn.RemoteAddr().String()
+			}
+		},
+		GotFirstResponseByte: func() {
+			t.record(&t.times.firstByte)
+		},
+	}
+	return request.WithContext(httptrace.WithClientTrace(request.Context(), trace))
+}
+
+// record sets the time once, a phase may be reported more than once when dialing several addresses
+func (t *tracer) record(at *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if at.IsZero() {
+		*at = time.Now()
+	}
+}
+
+// wrapBody records the response time, and the end of the body when it is read or closed
+func (t *tracer) wrapBody(response *http.Response) {
+	t.record(&t.times.responded)
+	if response.Body != nil {
+		response.Body = &tracedBody{ReadCloser: response.Body, tracer: t}
+	}
+}
+
+// timings computes the Timings from the recorded times
+func (t *tracer) timings() *Timings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	times := t.times
+	timings := &Timings{
+		DNSLookup:    between(times.dnsStart, times.dnsDone),
+		TCPConnect:   between(times.connectStart, times.connectDone),
+		TLSHandshake: between(times.tlsStart, times.tlsDone),
+		ConnReused:   times.reused,
+		RemoteAddr:   times.remoteAddr,
+	}
+	if !times.firstByte.IsZero() {
+		timings.TimeToFirstByte = between(times.start, times.firstByte)
+	}
+	if !times.bodyDone.IsZero() {
+		timings.BodyTransfer = between(times.firstByte, times.bodyDone)
+		timings.Total = between(times.start, times.bodyDone)
+	} else {
+		timings.Total = between(times.start, times.responded)
+	}
+	return timings
+}
+
+// between returns the duration between two recorded times, 0 if one is missing
+func between(from, to time.Time) time.Duration {
+	if from.IsZero() || to.IsZero() {
+		return 0
+	}
+	return to.Sub(from)
+}
+
+// tracedBody records the end of a response body
+type tracedBody struct {
+	io.ReadCloser
+	tracer *tracer
+}
+
+// Read implements io.Reader
+func (b *tracedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.tracer.record(&b.tracer.times.bodyDone)
+	}
+	return n, err
+}
+
+// Close implements io.Closer
+func (b *tracedBody) Close() error {
+	b.tracer.record(&b.tracer.times.bodyDone)
+	return b.ReadCloser.Close()
+}
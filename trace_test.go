@@ -0,0 +1,55 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient_test
+
+import (
+	"crypto/tls"
+	"github.com/panwenbin/ghttpclient"
+	"testing"
+)
+
+func TestTimings(t *testing.T) {
+	server, certPEM := newTLSServer(t, tls.NoClientCert)
+	var logged *ghttpclient.Timings
+	template := ghttpclient.NewTemplate().BaseUrl(server.URL).RootCAsFromPEM(certPEM).Trace().
+		Logger(ghttpclient.LoggerFunc(func(event ghttpclient.Event) {
+			if event.Kind == ghttpclient.EventBodyRead {
+				logged = event.Timings
+			}
+		}))
+
+	client := template.R().Url("/first").Get()
+	if _, err := client.ReadBodyClose(); err != nil {
+		t.Fatal(err)
+	}
+	timings := client.Timings()
+	if timings.TCPConnect <= 0 || timings.TLSHandshake <= 0 || timings.TimeToFirstByte <= 0 {
+		t.Errorf("expect connect, handshake and first byte timings, got %+v", timings)
+	}
+	if timings.BodyTransfer < 0 || timings.Total < timings.TimeToFirstByte {
+		t.Errorf("expect the total to include the first byte and the body transfer, got %+v", timings)
+	}
+	if timings.ConnReused {
+		t.Error("expect a new connection for the first request")
+	}
+	if timings.RemoteAddr != server.Listener.Addr().String() {
+		t.Errorf("expect %s, got %s", server.Listener.Addr(), timings.RemoteAddr)
+	}
+	if logged == nil || logged.Total != timings.Total {
+		t.Errorf("expect the body read event to carry the timings %+v, got %+v", timings, logged)
+	}
+
+	client = template.R().Url("/second").Get()
+	if _, err := client.ReadBodyClose(); err != nil {
+		t.Fatal(err)
+	}
+	timings = client.Timings()
+	if !timings.ConnReused || timings.TLSHandshake != 0 {
+		t.Errorf("expect the connection to be reused without handshake, got %+v", timings)
+	}
+
+	if ghttpclient.NewClient().Url(server.URL).RootCAsFromPEM(certPEM).Get().Timings() != nil {
+		t.Error("expect no timings without Trace")
+	}
+}
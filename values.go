@@ -0,0 +1,153 @@
+// Copyright 2019 潘文斌. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package ghttpclient
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EncodeValues encodes v as url values, v is an url.Values, a map of strings or string slices,
+// or a struct whose exported fields are named by the tag, such as `form:"name"` or `url:"name,omitempty"`
+// A field without the tag is named after the field, "-" skips it, and omitempty skips its zero value.
+// Slices repeat the name, embedded structs are flattened, nil pointers are skipped,
+// times are formatted as RFC 3339 and encoding.TextMarshaler values are marshaled.
+func EncodeValues(v any, tag string) (url.Values, error) {
+	switch values := v.(type) {
+	case url.Values:
+		return values, nil
+	case map[string][]string:
+		return values, nil
+	case map[string]string:
+		encoded := make(url.Values, len(values))
+		for key, value := range values {
+			encoded.Set(key, value)
+		}
+		return encoded, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return url.Values{}, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("can not encode %T as url values", v)
+	}
+	encoded := make(url.Values)
+	return encoded, encodeStruct(encoded, rv, tag)
+}
+
+// encodeStruct adds the fields of a struct to the values
+func encodeStruct(values url.Values, rv reflect.Value, tag string) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		fieldValue := rv.Field(i)
+		name, opts, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			for fieldValue.Kind() == reflect.Ptr && !fieldValue.IsNil() {
+				fieldValue = fieldValue.Elem()
+			}
+			if fieldValue.Kind() == reflect.Struct {
+				if err := encodeStruct(values, fieldValue, tag); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if strings.Contains(opts, "omitempty") && fieldValue.IsZero() {
+			continue
+		}
+		if err := encodeValue(values, name, fieldValue); err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+	}
+	return nil
+}
+
+// encodeValue adds a value, or each element of a slice, under the name
+func encodeValue(values url.Values, name string, rv reflect.Value) error {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if (rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8) || rv.Kind() == reflect.Array {
+		for i := 0; i < rv.Len(); i++ {
+			if err := encodeValue(values, name, rv.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	value, err := formatValue(rv)
+	if err != nil {
+		return err
+	}
+	values.Add(name, value)
+	return nil
+}
+
+// formatValue formats a scalar value
+func formatValue(rv reflect.Value) (string, error) {
+	if rv.CanInterface() {
+		switch v := rv.Interface().(type) {
+		case time.Time:
+			return v.Format(time.RFC3339), nil
+		case encoding.TextMarshaler:
+			text, err := v.MarshalText()
+			return string(text), err
+		}
+	}
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, rv.Type().Bits()), nil
+	case reflect.Slice:
+		return string(rv.Bytes()), nil
+	}
+	return "", fmt.Errorf("can not encode %s as an url value", rv.Type())
+}
+
+// Query adds v encoded as url values to the query of the url, see EncodeValues for the url tags
+// An encoding error is returned by the next action
+func (g *GHttpClient) Query(v any) *GHttpClient {
+	values, err := EncodeValues(v, "url")
+	if err != nil {
+		g.setOptionErr(fmt.Errorf("encode query: %w", err))
+		return g
+	}
+	if g.query == nil {
+		g.query = make(url.Values)
+	}
+	for key, vs := range values {
+		g.query[key] = append(g.query[key], vs...)
+	}
+	return g
+}